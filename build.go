@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io"
 	"io/ioutil"
+	"strings"
 	"text/template"
 
 	"github.com/miracl/casper/source"
@@ -14,12 +15,53 @@ var funcMap = template.FuncMap{
 	"last":    isLast,
 	"notLast": isNotLast,
 	"quote":   quote,
+
+	"default":  defaultValue,
+	"required": required,
+
+	"toJson":  toJSON,
+	"toYaml":  toYAML,
+	"indent":  indent,
+	"nindent": nindent,
+
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"replace": replace,
+	"split":   split,
+	"join":    join,
+	"trim":    strings.TrimSpace,
+
+	"dict":   dict,
+	"list":   list,
+	"keys":   keys,
+	"values": values,
+	"hasKey": hasKey,
+	"pluck":  pluck,
+	"merge":  merge,
+
+	"add": add,
+	"sub": sub,
+	"mul": mul,
+	"div": div,
+	"mod": mod,
+	"max": maxValue,
+	"min": minValue,
+
+	"b64enc":    b64enc,
+	"b64dec":    b64dec,
+	"sha256sum": sha256sum,
 }
 
 // BuildConfig represent a configuration.
 type BuildConfig struct {
 	Template io.Reader
 	Source   source.Getter
+	// Partials are the files, directories or glob patterns with templates
+	// that can be used by Template with template and include.
+	Partials []string
+	// Strict fails the build if the template uses a key that is not in the
+	// source instead of rendering "<no value>".
+	Strict bool
 }
 
 // Build creates the config based on the template and the environment files.
@@ -30,11 +72,13 @@ func (c BuildConfig) Build() ([]byte, error) {
 		return nil, errors.Wrap(err, "reading template failed")
 	}
 
-	cfgTmpl, err := template.New("config").
-		Funcs(funcMap).
-		Parse(string(cfgTmplBody))
+	cfgTmpl, err := parseTemplate(string(cfgTmplBody), c.Partials)
 	if err != nil {
-		return nil, errors.Wrap(err, "template error")
+		return nil, err
+	}
+
+	if c.Strict {
+		cfgTmpl.Option("missingkey=error")
 	}
 
 	var cfg bytes.Buffer
@@ -3,6 +3,7 @@ package casper
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/miracl/casper/source"
@@ -56,3 +57,47 @@ func TestBuild(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildStrict(t *testing.T) {
+	testCases := []struct {
+		tmpl string
+		res  string
+		err  string
+	}{
+		{`{"cfg1": "{{.key1}}", "cfg2": "{{.nested.key2}}"}`, `{"cfg1": "var1", "cfg2": "var2"}`, ""},
+		{`{"cfg1": "{{index . "key3" | default "def"}}"}`, `{"cfg1": "def"}`, ""},
+		{`{"cfg1": "{{.key3}}"}`, "", `map has no entry for key "key3"`},
+		{`{"cfg1": "{{.nested.key3}}"}`, "", `map has no entry for key "key3"`},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			config, err := BuildConfig{
+				Template: bytes.NewBufferString(tc.tmpl),
+				Source: source.NewSource(map[string]interface{}{
+					"key1":   "var1",
+					"nested": map[interface{}]interface{}{"key2": "var2"},
+				}),
+				Strict: true,
+			}.Build()
+			if (tc.err == "") != (err == nil) {
+				if err != nil {
+					t.Fatal(err)
+				} else {
+					t.Fatal("Build should have failed but haven't")
+				}
+			}
+
+			if err != nil {
+				if !strings.HasSuffix(err.Error(), tc.err) {
+					t.Errorf("Got %v; want %v", err, tc.err)
+				}
+				return
+			}
+
+			if string(config) != tc.res {
+				t.Errorf("Got %v; want %v", string(config), tc.res)
+			}
+		})
+	}
+}
@@ -9,15 +9,26 @@ import (
 	"github.com/miracl/casper"
 	"github.com/miracl/casper/source"
 	consulstorage "github.com/miracl/casper/storage/consul"
+	dirstorage "github.com/miracl/casper/storage/dir"
+	dotenvstorage "github.com/miracl/casper/storage/dotenv"
+	etcdstorage "github.com/miracl/casper/storage/etcd"
 	filestorage "github.com/miracl/casper/storage/file"
+	gitstorage "github.com/miracl/casper/storage/git"
+	kubestorage "github.com/miracl/casper/storage/kubernetes"
+	"github.com/miracl/casper/storage/multi"
+	redisstorage "github.com/miracl/casper/storage/redis"
+	sqlstorage "github.com/miracl/casper/storage/sql"
+	vaultstorage "github.com/miracl/casper/storage/vault"
 	"github.com/pkg/errors"
 )
 
 type context struct {
 	path     string
 	template *os.File
+	partials []string
 	storage  casper.Storage
 	source   *source.Source
+	stdin    bool // the standard input is already read by a source
 }
 
 func newContext(path string, opts ...func(*context) error) (*context, error) {
@@ -37,10 +48,21 @@ func (c *context) withSources(sources []string) error {
 	sourceTypes := map[string]getSourcer{
 		configScheme: getConfigSource,
 		"file":       getFileSource,
+		"dir":        getDirSource,
+		"env":        getEnvSource,
+		"consul":     getConsulSource,
+		"http":       getHTTPSource,
+		"https":      getHTTPSource,
+		"exec":       c.getExecSource,
+		stdinScheme:  c.getStdinSource,
 	}
 
 	sourceList := make([]source.Getter, len(sources))
 	for i, s := range sources {
+		if s == "-" {
+			s = stdinScheme + "://"
+		}
+
 		u, err := url.Parse(s)
 		if err != nil {
 			return errors.Wrapf(err, "parsing source %v failed", s)
@@ -63,10 +85,22 @@ func (c *context) withSources(sources []string) error {
 			return fmt.Errorf("invalid source format %v", u.Scheme)
 		}
 
-		sourceList[i], err = getSourcer(u)
+		mode := source.Override
+		if q := u.Query(); u.Scheme != configScheme && q.Get("merge") != "" {
+			mode, err = source.ParseMergeMode(q.Get("merge"))
+			if err != nil {
+				return errors.Wrapf(err, "parsing source %v failed", s)
+			}
+
+			q.Del("merge")
+			u.RawQuery = q.Encode()
+		}
+
+		src, err := getSourcer(u)
 		if err != nil {
 			return err
 		}
+		sourceList[i] = source.WithOrigin(source.WithMergeMode(src, mode), sourceOrigin(s, u))
 	}
 
 	var err error
@@ -74,30 +108,116 @@ func (c *context) withSources(sources []string) error {
 	return err
 }
 
+// sourceOrigin returns the name of the source in the provenance of its
+// values. The credentials and the parameters of the source are omitted.
+func sourceOrigin(s string, u *url.URL) string {
+	switch u.Scheme {
+	case configScheme:
+		return s
+	case stdinScheme:
+		return stdinScheme
+	}
+
+	origin := *u
+	origin.User = nil
+	origin.RawQuery = ""
+	return origin.String()
+}
+
 func withSources(sources []string) func(*context) error {
 	return func(c *context) error {
 		return c.withSources(sources)
 	}
 }
 
-func (c *context) withTemplate(path string) error {
+// withTemplate opens the template file. If path is a directory or a glob
+// pattern, the files starting with casper.PartialPrefix are partials of the
+// other file.
+func (c *context) withTemplate(path string, partials []string) error {
+	main, dirPartials := path, []string{}
+	if strings.ContainsAny(path, "*?[") || isDir(path) {
+		var err error
+		main, dirPartials, err = casper.SplitTemplates(path)
+		if err != nil {
+			return errors.Wrapf(err, "getting template %v failed", path)
+		}
+	}
+
 	var err error
-	c.template, err = os.Open(path)
+	c.template, err = os.Open(main)
+	c.partials = append(dirPartials, partials...)
 	return errors.Wrapf(err, "getting template %v failed", path)
 }
 
-func withTemplate(path string) func(*context) error {
+func withTemplate(path string, partials []string) func(*context) error {
 	return func(c *context) error {
-		return c.withTemplate(path)
+		return c.withTemplate(path, partials)
 	}
 }
 
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
 func (c *context) withFileStorage(path string) {
 	c.storage = filestorage.New(path)
 }
 
+func (c *context) withDirStorage(addr string) error {
+	var err error
+	c.storage, err = dirstorage.New(addr)
+	return errors.Wrap(err, "creating directory storage failed")
+}
+
 func (c *context) withConsulStorage(addr string) error {
 	var err error
 	c.storage, err = consulstorage.New(addr)
 	return errors.Wrap(err, "creating Consul storage failed")
 }
+
+func (c *context) withEtcdStorage(addr string) error {
+	var err error
+	c.storage, err = etcdstorage.New(addr)
+	return errors.Wrap(err, "creating etcd storage failed")
+}
+
+func (c *context) withVaultStorage(addr string) error {
+	var err error
+	c.storage, err = vaultstorage.New(addr)
+	return errors.Wrap(err, "creating Vault storage failed")
+}
+
+func (c *context) withKubernetesStorage(addr string) error {
+	var err error
+	c.storage, err = kubestorage.New(addr)
+	return errors.Wrap(err, "creating Kubernetes storage failed")
+}
+
+func (c *context) withRedisStorage(addr string) error {
+	var err error
+	c.storage, err = redisstorage.New(addr)
+	return errors.Wrap(err, "creating Redis storage failed")
+}
+
+func (c *context) withSQLStorage(addr string) error {
+	var err error
+	c.storage, err = sqlstorage.New(addr)
+	return errors.Wrap(err, "creating SQL storage failed")
+}
+
+func (c *context) withGitStorage(addr string) error {
+	var err error
+	c.storage, err = gitstorage.New(addr)
+	return errors.Wrap(err, "creating git storage failed")
+}
+
+func (c *context) withDotenvStorage(addr string) error {
+	var err error
+	c.storage, err = dotenvstorage.New(addr)
+	return errors.Wrap(err, "creating dotenv storage failed")
+}
+
+func (c *context) withMultiStorage(members []multi.Member) {
+	c.storage = multi.New(members...)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	cli "gopkg.in/urfave/cli.v2"
+	"gopkg.in/urfave/cli.v2/altsrc"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	envFlag     = "env"
+	inheritsKey = "inherits"
+)
+
+// environments are the profiles in the environments section of the config
+// file by their names.
+type environments map[string]map[string]interface{}
+
+func readEnvironments(path string) (environments, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading config %v failed", path)
+	}
+
+	config := struct {
+		Environments environments `yaml:"environments"`
+	}{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, errors.Wrapf(err, "parsing environments in config %v failed", path)
+	}
+
+	return config.Environments, nil
+}
+
+// chain returns the environment and the environments it inherits in order.
+func (envs environments) chain(name string) ([]string, error) {
+	chain := []string{}
+	for name != "" {
+		if strings.Contains(name, ".") {
+			return nil, fmt.Errorf("invalid environment name %v", name)
+		}
+
+		profile, ok := envs[name]
+		if !ok {
+			return nil, fmt.Errorf("environment %v is not defined", name)
+		}
+
+		if contains(chain, name) {
+			return nil, fmt.Errorf("environment %v inherits itself", name)
+		}
+		chain = append(chain, name)
+
+		parent, ok := profile[inheritsKey].(string)
+		if _, exists := profile[inheritsKey]; exists && !ok {
+			return nil, fmt.Errorf("%v of environment %v must be a name", inheritsKey, name)
+		}
+		name = parent
+	}
+
+	return chain, nil
+}
+
+// profileSource is the config file with the values overridden by the
+// selected environment and the environments it inherits.
+type profileSource struct {
+	altsrc.InputSourceContext
+	envs  environments
+	chain []string
+}
+
+// withEnvironment returns the config file with the values of the
+// environment. The config file is returned as it is if env is empty.
+func withEnvironment(isc altsrc.InputSourceContext, path, env string) (altsrc.InputSourceContext, error) {
+	if env == "" {
+		return isc, nil
+	}
+
+	envs, err := readEnvironments(path)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := envs.chain(env)
+	if err != nil {
+		return nil, errors.Wrapf(err, "selecting environment in config %v failed", path)
+	}
+
+	return &profileSource{isc, envs, chain}, nil
+}
+
+// name returns the name of the value in the first environment that sets it
+// or the name of the top level value.
+func (s *profileSource) name(name string) string {
+	for _, env := range s.chain {
+		if _, ok := s.envs[env][name]; ok {
+			return fmt.Sprintf("environments.%v.%v", env, name)
+		}
+	}
+	return name
+}
+
+func (s *profileSource) Int(name string) (int, error) {
+	return s.InputSourceContext.Int(s.name(name))
+}
+
+func (s *profileSource) Duration(name string) (time.Duration, error) {
+	return s.InputSourceContext.Duration(s.name(name))
+}
+
+func (s *profileSource) Float64(name string) (float64, error) {
+	return s.InputSourceContext.Float64(s.name(name))
+}
+
+func (s *profileSource) String(name string) (string, error) {
+	return s.InputSourceContext.String(s.name(name))
+}
+
+func (s *profileSource) StringSlice(name string) ([]string, error) {
+	return s.InputSourceContext.StringSlice(s.name(name))
+}
+
+func (s *profileSource) IntSlice(name string) ([]int, error) {
+	return s.InputSourceContext.IntSlice(s.name(name))
+}
+
+func (s *profileSource) Generic(name string) (cli.Generic, error) {
+	return s.InputSourceContext.Generic(s.name(name))
+}
+
+func (s *profileSource) Bool(name string) (bool, error) {
+	return s.InputSourceContext.Bool(s.name(name))
+}
+
+func envsAction(c *cli.Context) error {
+	path := c.String(configFlag)
+	envs, err := readEnvironments(path)
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for name := range envs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if parent, ok := envs[name][inheritsKey]; ok {
+			fmt.Printf("%v (inherits %v)\n", name, parent)
+			continue
+		}
+		fmt.Println(name)
+	}
+
+	return nil
+}
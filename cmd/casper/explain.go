@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/miracl/casper"
+	"github.com/miracl/casper/consul"
+	"github.com/miracl/casper/diff"
+	"github.com/miracl/casper/source"
+)
+
+// explainSentinel replaces a source value to find the keys that depend on it.
+const explainSentinel = "casper-explain-sentinel"
+
+// explainKeys returns the provenance of the source values with the key or
+// nested in it. All values are returned if the key is empty.
+func explainKeys(src *source.Source, key string) (string, error) {
+	prov := src.Provenance()
+
+	keys := []string{}
+	for k := range prov {
+		if key == "" || k == key || strings.HasPrefix(k, key+".") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	if len(keys) == 0 && key != "" {
+		return "", fmt.Errorf("key %v is not defined in the sources", key)
+	}
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintln(&buf, formatProvenance(k, prov[k]))
+	}
+	return buf.String(), nil
+}
+
+// listsStorage is implemented by the storages that flatten the lists of the
+// config in the configured way.
+type listsStorage interface {
+	Lists() consul.ListMode
+}
+
+// explainer shows the provenance of the source values used by each changed
+// key. The source values used by a key are found by building the template
+// again with each of them replaced. The template is built once per source
+// value, so explaining a big config with many source values takes time and
+// keeps a copy of the config per source value in memory.
+type explainer struct {
+	format string
+	prov   map[string]*source.Provenance
+	// config is the built config and replaced are the configs built with
+	// each source value replaced
+	config   []byte
+	replaced map[string][]byte
+	// used are the source keys used by each key of the config per list mode
+	used map[consul.ListMode]map[string][]string
+}
+
+func newExplainer(tmpl []byte, partials []string, src *source.Source, format string) (*explainer, error) {
+	build := func(s source.Getter) ([]byte, error) {
+		out, err := casper.BuildConfig{Template: bytes.NewReader(tmpl), Source: s, Partials: partials}.Build()
+		return []byte(out), err
+	}
+
+	config, err := build(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := flattenConfig(config, format, consul.IndexedLists); err != nil {
+		return nil, err
+	}
+
+	e := &explainer{format, src.Provenance(), config, map[string][]byte{}, map[consul.ListMode]map[string][]string{}}
+	for k, p := range e.prov {
+		out, err := build(source.NewSource(withValue(src.Get(), p.Path, explainSentinel)))
+		if err != nil {
+			// the value can't be replaced, e.g. it is ranged over
+			continue
+		}
+		e.replaced[k] = out
+	}
+
+	return e, nil
+}
+
+// usedKeys returns the source keys used by each key of the config flattened
+// with the list mode.
+func (e *explainer) usedKeys(lists consul.ListMode) map[string][]string {
+	if used, ok := e.used[lists]; ok {
+		return used
+	}
+
+	// the config is parsed in newExplainer and the list mode doesn't affect it
+	vals, _ := flattenConfig(e.config, e.format, lists)
+
+	used := map[string][]string{}
+	for k, out := range e.replaced {
+		replaced, err := flattenConfig(out, e.format, lists)
+		if err != nil {
+			continue
+		}
+
+		for outKey, v := range replaced {
+			if v != vals[outKey] {
+				used[outKey] = append(used[outKey], k)
+			}
+		}
+	}
+
+	for _, keys := range used {
+		sort.Strings(keys)
+	}
+
+	e.used[lists] = used
+	return used
+}
+
+// diff returns the changes with the provenance on the line of each changed
+// key. The changes that can't be listed per key are shown as by the storage.
+// The keys are flattened with the list mode of the storage.
+func (e *explainer) diff(s casper.Storage, cs casper.Changes, pretty bool) string {
+	kc, ok := cs.(casper.KeyChanges)
+	if !ok || len(kc.KeyChanges()) == 0 {
+		return s.Diff(cs, pretty)
+	}
+
+	lists := consul.IndexedLists
+	if ls, ok := s.(listsStorage); ok {
+		lists = ls.Lists()
+	}
+	used := e.usedKeys(lists)
+
+	changes := kc.KeyChanges()
+	sort.Sort(changes)
+
+	var buf bytes.Buffer
+	for _, c := range changes {
+		srcKeys := used[c.Key()]
+		if e.isSecret(srcKeys) {
+			c = redact(c)
+		}
+
+		line := c.String()
+		if pretty {
+			line = c.Pretty()
+		}
+		buf.WriteString(line)
+
+		// removed keys are not set by the sources
+		if _, ok := c.(*diff.Remove); !ok {
+			buf.WriteString("  # " + e.explain(srcKeys))
+		}
+		buf.WriteString("\n")
+	}
+
+	return buf.String()
+}
+
+// isSecret reports whether any of the source values is secret.
+func (e *explainer) isSecret(srcKeys []string) bool {
+	for _, k := range srcKeys {
+		if e.prov[k].Secret {
+			return true
+		}
+	}
+	return false
+}
+
+// redact returns the change with the new value redacted.
+func redact(c diff.KVChange) diff.KVChange {
+	switch change := c.(type) {
+	case *diff.Add:
+		return diff.NewAdd(c.Key(), source.Redacted)
+	case *diff.Update:
+		return diff.NewUpdate(c.Key(), change.Val(), source.Redacted)
+	}
+	return c
+}
+
+// explain returns the origins of the source values.
+func (e *explainer) explain(srcKeys []string) string {
+	if len(srcKeys) == 0 {
+		return "not set by the sources"
+	}
+
+	strs := make([]string, len(srcKeys))
+	for i, k := range srcKeys {
+		strs[i] = fmt.Sprintf("%v from %v", k, joinOrigins(e.prov[k].Origins))
+		if len(e.prov[k].Shadowed) > 0 {
+			strs[i] += fmt.Sprintf(", shadows %v", joinOrigins(e.prov[k].Shadowed))
+		}
+	}
+	return strings.Join(strs, "; ")
+}
+
+func formatProvenance(key string, p *source.Provenance) string {
+	s := fmt.Sprintf("%v: %v from %v", key, p, joinOrigins(p.Origins))
+	if len(p.Shadowed) > 0 {
+		s += fmt.Sprintf("; shadows %v", joinOrigins(p.Shadowed))
+	}
+	return s
+}
+
+func joinOrigins(origins []source.Origin) string {
+	strs := make([]string, len(origins))
+	for i, o := range origins {
+		strs[i] = o.String()
+	}
+	return strings.Join(strs, ", ")
+}
+
+// flattenConfig parses the config and returns its values by their keys
+// flattened like for Consul storage with the list mode.
+func flattenConfig(data []byte, format string, lists consul.ListMode) (map[string]string, error) {
+	flat, err := consul.GetChanges(nil, data, format, lists)
+	if err != nil {
+		return nil, err
+	}
+
+	vals := map[string]string{}
+	for _, c := range flat {
+		vals[c.Key] = c.NewVal
+	}
+	return vals, nil
+}
+
+// withValue returns a copy of the map with the value on the path replaced.
+// Only the maps on the path are copied.
+func withValue(m map[string]interface{}, path []string, v interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m))
+	for k, vi := range m {
+		c[k] = vi
+	}
+
+	if len(path) == 1 {
+		c[path[0]] = v
+		return c
+	}
+
+	switch child := c[path[0]].(type) {
+	case map[string]interface{}:
+		c[path[0]] = withValue(child, path[1:], v)
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(child))
+		for k, vi := range child {
+			converted[fmt.Sprint(k)] = vi
+		}
+		c[path[0]] = withValue(converted, path[1:], v)
+	}
+
+	return c
+}
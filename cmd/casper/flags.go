@@ -12,34 +12,46 @@ import (
 	"gopkg.in/urfave/cli.v2/altsrc"
 )
 
-// sourcesSliceFlag is the flag type that wraps cli.sourcesSliceFlag to allow
-// for other values to be specified
-type sourcesSliceFlag struct {
+// pathsSliceFlag is the flag type that wraps cli.StringSliceFlag to allow
+// for other values to be specified. The paths in the values from the config
+// file are made relative to the config file with fix.
+type pathsSliceFlag struct {
 	*cli.StringSliceFlag
 	set *flag.FlagSet
+	fix func(dir string, value []string) ([]string, error)
 }
 
-// newSourcesSliceFlag creates a new StringSliceFlag
-func newSourcesSliceFlag(fl *cli.StringSliceFlag) *sourcesSliceFlag {
-	return &sourcesSliceFlag{StringSliceFlag: fl, set: nil}
+// newSourcesSliceFlag creates a new StringSliceFlag for sources
+func newSourcesSliceFlag(fl *cli.StringSliceFlag) *pathsSliceFlag {
+	return &pathsSliceFlag{StringSliceFlag: fl, set: nil, fix: fixPathsForSources}
+}
+
+// newStoragesSliceFlag creates a new StringSliceFlag for storages
+func newStoragesSliceFlag(fl *cli.StringSliceFlag) *pathsSliceFlag {
+	return &pathsSliceFlag{StringSliceFlag: fl, set: nil, fix: fixPathsForStorages}
+}
+
+// newPathsSliceFlag creates a new StringSliceFlag for paths
+func newPathsSliceFlag(fl *cli.StringSliceFlag) *pathsSliceFlag {
+	return &pathsSliceFlag{StringSliceFlag: fl, set: nil, fix: fixPaths}
 }
 
 // Apply saves the flagSet for later usage calls, then calls the
 // wrapped StringSliceFlag.Apply
-func (f *sourcesSliceFlag) Apply(set *flag.FlagSet) {
+func (f *pathsSliceFlag) Apply(set *flag.FlagSet) {
 	f.set = set
 	f.StringSliceFlag.Apply(set)
 }
 
 // ApplyWithError saves the flagSet for later usage calls, then calls the
 // wrapped StringSliceFlag.ApplyWithError
-func (f *sourcesSliceFlag) ApplyWithError(set *flag.FlagSet) error {
+func (f *pathsSliceFlag) ApplyWithError(set *flag.FlagSet) error {
 	f.set = set
 	return f.StringSliceFlag.ApplyWithError(set)
 }
 
 // ApplyInputSourceValue applies a StringSlice value to the flagSet if required
-func (f *sourcesSliceFlag) ApplyInputSourceValue(context *cli.Context, isc altsrc.InputSourceContext) error {
+func (f *pathsSliceFlag) ApplyInputSourceValue(context *cli.Context, isc altsrc.InputSourceContext) error {
 	if f.set != nil {
 		if !context.IsSet(f.Name) && !isEnvVarSet(f.EnvVars) {
 			value, err := isc.StringSlice(f.StringSliceFlag.Name)
@@ -52,7 +64,7 @@ func (f *sourcesSliceFlag) ApplyInputSourceValue(context *cli.Context, isc altsr
 				return err
 			}
 
-			value, err = fixPathsForSources(dir, value)
+			value, err = f.fix(dir, value)
 			if err != nil {
 				return err
 			}
@@ -100,7 +112,7 @@ func fixPathsForSource(dir, value string) (string, error) {
 		return "", errors.Wrapf(err, "parsing source %v failed", value)
 	}
 
-	if u.Scheme == "file" {
+	if u.Scheme == "file" || u.Scheme == "dir" || (u.Scheme == "exec" && strings.Contains(u.Host+u.Path, "/")) {
 		fixed, err := fixPathsForFileSource(dir, u)
 		if err != nil {
 			return "", errors.Wrapf(err, "converting file source path %v to absolute failed", u)
@@ -128,6 +140,55 @@ func fixPathsForFileSource(dir string, u *url.URL) (string, error) {
 	return u.String(), nil
 }
 
+func fixPathsForStorages(dir string, value []string) ([]string, error) {
+	for i, v := range value {
+		fixed, err := fixPathsForStorage(dir, v)
+		if err != nil {
+			return value, err
+		}
+		value[i] = fixed
+	}
+	return value, nil
+}
+
+// fixPathsForStorage makes the path of the storages stored in files relative
+// to dir.
+func fixPathsForStorage(dir, value string) (string, error) {
+	typ, addr := parseStorage(value)
+
+	switch typ {
+	case "file", "dir":
+		if addr == "" || filepath.IsAbs(addr) {
+			return value, nil
+		}
+		return typ + "=" + filepath.Join(dir, addr), nil
+	case "dotenv", "git":
+		u, err := url.Parse(addr)
+		if err != nil {
+			return "", errors.Wrapf(err, "parsing storage %v failed", value)
+		}
+
+		if addr == "" || u.Scheme != "" || filepath.IsAbs(u.Path) {
+			return value, nil
+		}
+
+		u.Path = filepath.Join(dir, u.Path)
+		return typ + "=" + u.String(), nil
+	}
+
+	return value, nil
+}
+
+// fixPaths makes the relative paths relative to dir.
+func fixPaths(dir string, value []string) ([]string, error) {
+	for i, v := range value {
+		if !filepath.IsAbs(v) {
+			value[i] = filepath.Join(dir, v)
+		}
+	}
+	return value, nil
+}
+
 func isEnvVarSet(envVars []string) bool {
 	for _, envVar := range envVars {
 		if _, ok := syscall.Getenv(envVar); ok {
@@ -32,6 +32,14 @@ func TestFixPathsForFileSource(t *testing.T) {
 			u: "file://../config/source.yaml?a=1",
 			f: "file:///config/source.yaml?a=1",
 		},
+		{
+			u: "file://values/*.yaml",
+			f: "file:///config/values/%2A.yaml",
+		},
+		{
+			u: "dir://values/",
+			f: "dir:///config/values",
+		},
 	}
 
 	for i, tc := range cases {
@@ -52,3 +60,33 @@ func TestFixPathsForFileSource(t *testing.T) {
 		})
 	}
 }
+
+func TestFixPathsForStorage(t *testing.T) {
+	dir := "/config"
+	cases := []struct {
+		s string
+		f string
+	}{
+		{"file=output.yaml", "file=/config/output.yaml"},
+		{"file=/output.yaml", "file=/output.yaml"},
+		{"file", "file"},
+		{"dir=../output", "dir=/output"},
+		{"dotenv=.env?style=env", "dotenv=/config/.env?style=env"},
+		{"git=?path=config.yaml", "git=/config?path=config.yaml"},
+		{"git=file:///repo?path=config.yaml", "git=file:///repo?path=config.yaml"},
+		{"consul=http://127.0.0.1:8500/", "consul=http://127.0.0.1:8500/"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			f, err := fixPathsForStorage(dir, tc.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if f != tc.f {
+				t.Errorf("Got: %v; Expected: %v", f, tc.f)
+			}
+		})
+	}
+}
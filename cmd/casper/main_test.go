@@ -25,6 +25,11 @@ func TestExample(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	os.Setenv("CASPER_TEST_PLACEHOLDER1", "val1")
+	os.Setenv("CASPER_TEST_PLACEHOLDER2", "val2")
+	defer os.Unsetenv("CASPER_TEST_PLACEHOLDER1")
+	defer os.Unsetenv("CASPER_TEST_PLACEHOLDER2")
+
 	outputFileName := filepath.Join(wd, "../../example/output.yaml")
 	outputFileData, err := ioutil.ReadFile(outputFileName)
 	if err != nil {
@@ -59,6 +64,9 @@ func TestExample(t *testing.T) {
 		// without config file
 		{cmd: "casper build -t ../../example/template.yaml -s placeholder1=val1 -s placeholder2=val2", out: outputFile},
 
+		// with env source
+		{cmd: "casper build -t ../../example/template.yaml -s env://?prefix=CASPER_TEST_&lower=true", out: outputFile},
+
 		// with bad source
 		{cmd: "casper build -t ../../example/template.yaml -s placeholder1=val1 -s source.yaml", out: outputFile, err: "creating context failed: invalid source: source.yaml"},
 
@@ -71,6 +79,15 @@ func TestExample(t *testing.T) {
 		{cmd: "casper push -s placeholder1=val1a -s placeholder2=val2a --plain --force", out: changes + applyingChanges, pwd: "../../example"},
 		{cmd: "casper push -s placeholder1=val1a -s placeholder2=val2a --plain", out: changes + prompt + canceled + "\n", pwd: "../../example"},
 
+		// with multiple storages
+		{
+			cmd: "casper diff -s placeholder1=val1a -s placeholder2=val2a --plain -storages file=output.yaml -storages file=./output.yaml",
+			out: "==> file output.yaml <==\n" + strings.TrimRight(changes, "\n") + "\n\n" +
+				"==> file ./output.yaml <==\n" + strings.TrimRight(changes, "\n") + "\n\n",
+			pwd: "../../example",
+		},
+		{cmd: "casper fetch -storages file=output.yaml -storages invalid", err: "invalid storage type 'invalid'"},
+
 		//
 		// Tests for correct relative path resolving.
 		//
@@ -138,6 +155,335 @@ func TestExample(t *testing.T) {
 	}
 }
 
+func TestFilesSources(t *testing.T) {
+	files := map[string]string{
+		"template.yaml":            "key1: {{.placeholder1}}\nkey2: {{.placeholder2}}\n",
+		"values/a.yaml":            "placeholder1: val1\n",
+		"values/b.yaml":            "placeholder2: val2\n",
+		"values/notes.txt":         "not a source",
+		"values/team/c.json":       `{"placeholder3": "val3"}`,
+		"config/config.yaml":       "template: ../template.yaml\nsources:\n- file://../values/*.yaml\n",
+		"config/dir.yaml":          "template: ../template.yaml\nsources:\n- dir://../values\n",
+		"invalid/placeholder.yaml": "placeholder1: [",
+		"other/p2.conf":            "placeholder2 = \"val2\"\n",
+		"mixed/a.ini":              "placeholder1 = val1\n",
+		"mixed/b.env":              "placeholder2=val2\n",
+		"mixed/c.toml":             "[team]\nname = \"x\"\n",
+		"layers/base.yaml":         "placeholder1: val0\nplaceholder2: val2\n",
+		"layers/prod.yaml":         "placeholder1: val1\n",
+	}
+	dir, cleanup := tempDir(t, files)
+	defer cleanup()
+
+	out := "key1: val1\nkey2: val2\n"
+	cases := []appCase{
+		{cmd: "casper build -s file://values/*.yaml", out: out},
+		{cmd: "casper build -s file://values/[ab].yaml", out: out},
+		{cmd: "casper build -s dir://values/", out: out},
+		{cmd: "casper -c config/config.yaml build", out: out},
+		{cmd: "casper -c config/dir.yaml build", out: out},
+		{cmd: "casper build -s file://values/a.yaml -s file://other/p2.conf?format=toml", out: out},
+		{cmd: "casper build -s dir://mixed", out: out},
+		{cmd: "casper build -s file://layers/base.yaml -s file://layers/prod.yaml", out: out},
+		{cmd: "casper build -s file://layers/base.yaml -s file://layers/prod.yaml?merge=error", err: "creating context failed: key placeholder1 has conflicting values val0 and val1"},
+		{cmd: "casper build -s file://layers/base.yaml -s file://layers/prod.yaml?merge=maybe", err: "creating context failed: parsing source file://layers/prod.yaml?merge=maybe failed: invalid merge mode 'maybe'"},
+		{cmd: "casper build -s file://values/*.yml", err: "creating context failed: no files match values/*.yml"},
+		{cmd: "casper build -s dir://invalid", err: "creating context failed: creating new file source invalid/placeholder.yaml failed: parsing yaml failed: yaml: line 1: did not find expected node content"},
+		{cmd: "casper build -s file://other/p2.conf", err: "creating context failed: creating new file source other/p2.conf failed: unsupported file source format 'conf'"},
+		{cmd: "casper build -s dir://missing", err: "creating context failed: reading directory missing failed: lstat missing: no such file or directory"},
+	}
+
+	runApp(t, dir, cases, equal)
+}
+
+func TestExecSource(t *testing.T) {
+	files := map[string]string{
+		"template.yaml": "key1: {{.placeholder1}}\nkey2: {{.placeholder2}}\n",
+		"values.sh":     "#!/bin/sh\necho \"placeholder1: $1\"\necho 'placeholder2: val2'\n",
+		"config.yaml":   "allow-exec:\n- ./values.sh\nsources:\n- exec://./values.sh?arg=val1\n",
+		"other.yaml":    "sources:\n- exec://./values.sh?arg=val1\n",
+	}
+	dir, cleanup := tempDir(t, files)
+	defer cleanup()
+
+	valuesPath := filepath.Join(dir, "values.sh")
+	cases := []appCase{
+		{cmd: "casper build", out: "key1: val1\nkey2: val2\n"},
+		{cmd: "casper build -s exec://./values.sh?arg=val1a", out: "key1: val1a\nkey2: val2\n"},
+		{cmd: "casper -c other.yaml build", err: fmt.Sprintf("creating context failed: command %v is not allowed, add it to allow-exec in the config file", valuesPath)},
+		{cmd: "casper -c missing.yaml build -s exec://./values.sh", err: fmt.Sprintf("creating context failed: command %v is not allowed, add it to allow-exec in the config file", valuesPath)},
+		{cmd: "casper build -s exec://./values.sh?timeout=never", err: `creating context failed: parsing timeout never failed: time: invalid duration "never"`},
+	}
+
+	runApp(t, dir, cases, equal)
+}
+
+func TestStdinSource(t *testing.T) {
+	dir, cleanup := tempDir(t, map[string]string{
+		"template.yaml": "key1: {{.placeholder1}}\nkey2: {{.placeholder2}}\n",
+	})
+	defer cleanup()
+
+	cases := []appCase{
+		{cmd: "casper build -s -", stdin: "placeholder1: val1\nplaceholder2: val2\n", out: "key1: val1\nkey2: val2\n"},
+		{cmd: "casper build -s stdin://?format=json", stdin: `{"placeholder1": "val1", "placeholder2": "val2"}`, out: "key1: val1\nkey2: val2\n"},
+		{cmd: "casper build -s - -s placeholder2=val2", stdin: `{"placeholder1": "val1"}`, out: "key1: val1\nkey2: val2\n"},
+		{
+			cmd:   "casper push -s - --plain --force -storage file -file-path output.yaml",
+			stdin: "placeholder1: val1\nplaceholder2: val2\n",
+			out:   "-\n+key1: val1\nkey2: val2\n\nApplying changes...\n",
+		},
+		{cmd: "casper push -s - -storage file -file-path output.yaml", err: "reading sources from stdin requires --force"},
+		{cmd: "casper push -s stdin://?format=json -storage file -file-path output.yaml", err: "reading sources from stdin requires --force"},
+		{cmd: "casper build -s - -s -", stdin: "placeholder1: val1\n", err: "creating context failed: stdin can be used only once as a source"},
+		{cmd: "casper build -s stdin://?format=json", stdin: "placeholder1: val1\n", err: "creating context failed: reading source from stdin failed: parsing json failed: invalid character 'p' looking for beginning of value"},
+	}
+
+	runApp(t, dir, cases, equal)
+}
+
+func TestExplain(t *testing.T) {
+	files := map[string]string{
+		"template.yaml": "key1: {{.placeholder1}}\nkey2: {{.db.host}}:{{.db.port}}\nkey3: static\n",
+		"base.yaml":     "placeholder1: val1\ndb:\n  host: localhost\n  port: 5432\n",
+		"prod.yaml":     "db:\n  host: db.example.com\n",
+		"output.yaml":   "key1: val1\nkey2: localhost:5432\nkey3: static\n",
+		"lists.yaml":    "hosts:\n- {{.db.host}}\n- backup\n",
+	}
+	dir, cleanup := tempDir(t, files)
+	defer cleanup()
+
+	sources := "-s file://base.yaml -s file://prod.yaml -s placeholder1=val1a"
+	cases := []appCase{
+		{
+			cmd: "casper explain " + sources,
+			out: "db.host: db.example.com from file://prod.yaml:2; shadows file://base.yaml:3\n" +
+				"db.port: 5432 from file://base.yaml:4\n" +
+				"placeholder1: val1a from placeholder1=val1a; shadows file://base.yaml:1\n",
+		},
+		{
+			cmd: "casper explain " + sources + " db.port",
+			out: "db.port: 5432 from file://base.yaml:4\n",
+		},
+		{
+			cmd: "casper diff --plain --explain -storage file -file-path output.yaml " + sources,
+			out: "-key1=val1\n" +
+				"+key1=val1a  # placeholder1 from placeholder1=val1a, shadows file://base.yaml:1\n" +
+				"-key2=localhost:5432\n" +
+				"+key2=db.example.com:5432  # db.host from file://prod.yaml:2, shadows file://base.yaml:3; db.port from file://base.yaml:4\n\n",
+		},
+		// the file doesn't exist before the first push
+		{
+			cmd: "casper diff --plain --explain -storage file -file-path missing.yaml " + sources,
+			out: "+key1=val1a  # placeholder1 from placeholder1=val1a, shadows file://base.yaml:1\n" +
+				"+key2=db.example.com:5432  # db.host from file://prod.yaml:2, shadows file://base.yaml:3; db.port from file://base.yaml:4\n" +
+				"+key3=static  # not set by the sources\n\n",
+		},
+		{
+			cmd: "casper diff --plain --explain -storages file=output.yaml -storages file=missing.yaml " + sources,
+			out: "==> file output.yaml <==\n" +
+				"-key1=val1\n" +
+				"+key1=val1a  # placeholder1 from placeholder1=val1a, shadows file://base.yaml:1\n" +
+				"-key2=localhost:5432\n" +
+				"+key2=db.example.com:5432  # db.host from file://prod.yaml:2, shadows file://base.yaml:3; db.port from file://base.yaml:4\n" +
+				"\n" +
+				"==> file missing.yaml <==\n" +
+				"+key1=val1a  # placeholder1 from placeholder1=val1a, shadows file://base.yaml:1\n" +
+				"+key2=db.example.com:5432  # db.host from file://prod.yaml:2, shadows file://base.yaml:3; db.port from file://base.yaml:4\n" +
+				"+key3=static  # not set by the sources\n\n",
+		},
+		// the keys are flattened with the list mode of the storage
+		{
+			cmd: "casper diff --plain --explain -t lists.yaml -storage dir -dir-path out/ " + sources,
+			out: "+hosts/0=db.example.com  # db.host from file://prod.yaml:2, shadows file://base.yaml:3\n" +
+				"+hosts/1=backup  # not set by the sources\n\n",
+		},
+		{
+			cmd: "casper diff --plain --explain -t lists.yaml -storage dir -dir-path out/?lists=json " + sources,
+			out: "+hosts=[\"db.example.com\",\"backup\"]  # db.host from file://prod.yaml:2, shadows file://base.yaml:3\n\n",
+		},
+		{
+			cmd: "casper diff --plain --explain -storage file -file-path output.yaml -s file://base.yaml",
+			out: "No changes\n",
+		},
+		{cmd: "casper explain " + sources + " db.user", err: "key db.user is not defined in the sources"},
+	}
+
+	runApp(t, dir, cases, equal)
+}
+
+func TestSOPSSource(t *testing.T) {
+	secrets, err := ioutil.ReadFile("../../source/testdata/secrets.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"template.yaml": "user: {{.db.user}}\npassword: {{.db.password}}\nregion: {{.region_unencrypted}}\n",
+		"secrets.yaml":  string(secrets),
+		"output.yaml":   "user: admin\npassword: old\nregion: eu-west-1\n",
+	}
+	keyFile, err := filepath.Abs("../../source/testdata/age.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, cleanup := tempDir(t, files)
+	defer cleanup()
+
+	os.Setenv("SOPS_AGE_KEY_FILE", keyFile)
+	defer os.Unsetenv("SOPS_AGE_KEY_FILE")
+
+	cases := []appCase{
+		{cmd: "casper build -s file://secrets.yaml", out: "user: admin\npassword: s3cr3t\nregion: eu-west-1\n"},
+		{cmd: "casper explain -s file://secrets.yaml db.password", out: "db.password: <redacted> from file://secrets.yaml:3\n"},
+		{
+			cmd: "casper diff --plain --explain -storage file -file-path output.yaml -s file://secrets.yaml",
+			out: "-password=old\n+password=<redacted>  # db.password from file://secrets.yaml:3\n\n",
+		},
+		{
+			cmd: "casper build -s file://secrets.yaml",
+			env: map[string]string{"SOPS_AGE_KEY_FILE": "missing.key"},
+			err: "creating context failed: creating new sops source secrets.yaml failed: decrypting sops document failed: Error getting data key: 0 successful groups required, got 0",
+		},
+	}
+
+	runApp(t, dir, cases, equal)
+}
+
+func TestEnvironments(t *testing.T) {
+	config := `template: template.yaml
+storage: file
+file-path: output.yaml
+sources:
+- placeholder1=base1
+- placeholder2=base2
+environments:
+  staging:
+    file-path: staging.yaml
+    sources:
+    - placeholder1=staging1
+    - placeholder2=staging2
+  production:
+    inherits: staging
+    sources:
+    - file://production.yaml
+  loop1:
+    inherits: loop2
+  loop2:
+    inherits: loop1
+  orphan:
+    inherits: missing
+`
+	files := map[string]string{
+		"config/config.yaml":     config,
+		"config/template.yaml":   "key1: {{.placeholder1}}\nkey2: {{.placeholder2}}\n",
+		"config/production.yaml": "placeholder1: production1\nplaceholder2: production2\n",
+		"config/output.yaml":     "key1: base1\n",
+		"config/staging.yaml":    "key1: staging1\n",
+	}
+	dir, cleanup := tempDir(t, files)
+	defer cleanup()
+
+	// the errors in the config file are wrapped by altsrc
+	inputSourceErr := "Unable to create input source with context: inner error: \n"
+
+	cases := []appCase{
+		{cmd: "casper -c config/config.yaml build", out: "key1: base1\nkey2: base2\n"},
+		{cmd: "casper -c config/config.yaml --env staging build", out: "key1: staging1\nkey2: staging2\n"},
+		{cmd: "casper -c config/config.yaml --env production build", out: "key1: production1\nkey2: production2\n"},
+		{cmd: "casper -c config/config.yaml --env production build -s placeholder1=flag1 -s placeholder2=flag2", out: "key1: flag1\nkey2: flag2\n"},
+		{cmd: "casper -c config/config.yaml fetch", out: "key1: base1\n\n"},
+		{cmd: "casper -c config/config.yaml --env production fetch", out: "key1: staging1\n\n"},
+		{cmd: "casper -c config/config.yaml envs", out: "loop1 (inherits loop2)\nloop2 (inherits loop1)\norphan (inherits missing)\nproduction (inherits staging)\nstaging\n"},
+		{cmd: "casper -c config/config.yaml --env missing build", err: inputSourceErr + "'selecting environment in config config/config.yaml failed: environment missing is not defined'"},
+		{cmd: "casper -c config/config.yaml --env orphan build", err: inputSourceErr + "'selecting environment in config config/config.yaml failed: environment missing is not defined'"},
+		{cmd: "casper -c config/config.yaml --env loop1 build", err: inputSourceErr + "'selecting environment in config config/config.yaml failed: environment loop1 inherits itself'"},
+		{cmd: "casper -c missing.yaml --env staging build", err: inputSourceErr + "'environment staging requires config missing.yaml'"},
+	}
+
+	runApp(t, dir, cases, equal)
+}
+
+func TestStrict(t *testing.T) {
+	files := map[string]string{
+		"template.yaml": "key1: {{.placehodler1}}\n",
+		"strict.yaml":   "template: template.yaml\nstrict: true\nsources:\n- placeholder1=val1\n",
+		"fixed.yaml":    "key1: {{.placeholder1}}\n",
+	}
+	dir, cleanup := tempDir(t, files)
+	defer cleanup()
+
+	// the position in the template error depends on the go version
+	missingKeyErr := `map has no entry for key "placehodler1"`
+
+	cases := []appCase{
+		{cmd: "casper build -s placeholder1=val1", out: "key1: <no value>\n"},
+		{cmd: "casper build --strict -s placeholder1=val1", err: missingKeyErr},
+		{cmd: "casper -c strict.yaml build", err: missingKeyErr},
+		{cmd: "casper -c strict.yaml diff --file-path output.yaml", err: missingKeyErr},
+		{cmd: "casper -c strict.yaml push --file-path output.yaml --force", err: missingKeyErr},
+		{cmd: "casper build --strict -t fixed.yaml -s placeholder1=val1 -s placeholder2=val2", out: "key1: val1\n"},
+	}
+
+	runApp(t, dir, cases, strings.HasSuffix)
+}
+
+func TestTemplatePartials(t *testing.T) {
+	files := map[string]string{
+		"shared/logging.tmpl":        `{{define "logging"}}level: {{.level}}{{end}}`,
+		"service/config.yaml":        "template: templates\npartials:\n- ../shared\nsources:\n- level=info\n- port=80\n",
+		"service/templates/app.yaml": "port: {{.port}}\n{{template \"_db.yaml\" .}}\nlog:{{include \"logging\" . | nindent 2}}\n",
+		"service/templates/_db.yaml": "db: {{.db | default \"localhost\"}}",
+	}
+	dir, cleanup := tempDir(t, files)
+	defer cleanup()
+
+	cases := []appCase{
+		{cmd: "casper -c service/config.yaml build", out: "port: 80\ndb: localhost\nlog:\n  level: info\n"},
+		{cmd: "casper -c service/config.yaml build -t service/templates/*.yaml -s db=db1 -s level=debug -s port=81", out: "port: 81\ndb: db1\nlog:\n  level: debug\n"},
+		{cmd: "casper build -t service/templates/app.yaml -s level=info", err: "building the source failed: executing template failed: "},
+		{cmd: "casper build -t service/templates --partials missing -s level=info", err: "building the source failed: no templates match missing"},
+		{cmd: "casper build -t service/*.tmpl", err: "creating context failed: getting template service/*.tmpl failed: no templates match service/*.tmpl"},
+	}
+
+	runApp(t, dir, cases, strings.HasPrefix)
+}
+
+func TestSchema(t *testing.T) {
+	files := map[string]string{
+		"config/config.yaml":   "template: template.yaml\nschema: schema.json\nfile-path: output.yaml\n",
+		"config/template.yaml": "port: {{.port}}\nhost: {{.host}}\n",
+		"config/schema.json":   `{"type": "object", "properties": {"port": {"type": "integer"}, "host": {"type": "string", "minLength": 1}}}`,
+		"config/output.yaml":   "port: 80\nhost: old\n",
+	}
+	dir, cleanup := tempDir(t, files)
+	defer cleanup()
+
+	violations := "validating the config failed: config doesn't match the schema:\n" +
+		"\t$.host: Invalid type. Expected: string, given: null\n" +
+		"\t$.port: Invalid type. Expected: integer, given: string"
+
+	cases := []appCase{
+		{cmd: "casper -c config/config.yaml build -s port=81 -s host=new", out: "port: 81\nhost: new\n"},
+		{cmd: "casper -c config/config.yaml build -s port=http -s host=", err: violations},
+		{cmd: "casper -c config/config.yaml diff -s port=http -s host=", err: violations},
+		{cmd: "casper -c config/config.yaml push --force -s port=http -s host=", err: violations},
+		{cmd: "casper build -t config/template.yaml --schema config/missing.json -s port=81 -s host=new", err: "validating the config failed: loading schema config/missing.json failed"},
+	}
+
+	runApp(t, dir, cases, strings.HasPrefix)
+
+	// the invalid config is not pushed
+	data, err := ioutil.ReadFile(filepath.Join(dir, "config/output.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != files["config/output.yaml"] {
+		t.Errorf("Got %v; want %v", string(data), files["config/output.yaml"])
+	}
+}
+
 func TestConsulIntegration(t *testing.T) {
 	if !*full {
 		t.SkipNow()
@@ -251,6 +597,7 @@ func TestAppErrors(t *testing.T) {
 		{cmd: "casper build -t ../../example/template.yaml -s key:val", err: "creating context failed: invalid source format key"},
 		{cmd: "casper diff -t ../../example/template.yaml -s key:val", err: "creating context failed: invalid source format key"},
 		{cmd: "casper push -t ../../example/template.yaml -s key:val", err: "creating context failed: invalid source format key"},
+		{cmd: "casper build -t ../../example/template.yaml -s env://?lower=maybe", err: `creating context failed: parsing lower maybe failed: strconv.ParseBool: parsing "maybe": invalid syntax`},
 	}
 
 	for i, tc := range cases {
@@ -271,6 +618,110 @@ func TestAppErrors(t *testing.T) {
 
 }
 
+// appCase is a command run by runApp with its expected output or error.
+type appCase struct {
+	cmd   string            // command
+	stdin string            // content of stdin
+	env   map[string]string // environment variables set for the command
+	out   string            // expected output
+	err   string            // expected error
+}
+
+// runApp runs the cases in the directory. The errors are compared with the
+// expected ones by match.
+func runApp(t *testing.T, dir string, cases []appCase, match func(err, expected string) bool) {
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			os.Chdir(dir)
+
+			for k, v := range tc.env {
+				old, ok := os.LookupEnv(k)
+				os.Setenv(k, v)
+				defer func(k string) {
+					if ok {
+						os.Setenv(k, old)
+					} else {
+						os.Unsetenv(k)
+					}
+				}(k)
+			}
+
+			stdin, err := ioutil.TempFile("", "stdin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(stdin.Name())
+			defer stdin.Close()
+
+			if _, err := stdin.WriteString(tc.stdin); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := stdin.Seek(0, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			oldStdin := os.Stdin
+			os.Stdin = stdin
+			defer func() { os.Stdin = oldStdin }()
+
+			if tc.err != "" {
+				app := newApp()
+				app.Writer = ioutil.Discard
+				err := app.Run(strings.Split(tc.cmd, " "))
+				if err == nil || !match(err.Error(), tc.err) {
+					t.Fatalf("\nunexpected error: %v\n\texpected: %v", err, tc.err)
+				}
+				return
+			}
+
+			os.Args = strings.Split(tc.cmd, " ")
+			out := getStdout(t, main)
+			if out != tc.out {
+				t.Errorf("\ntest:/$ %v\n%v;\nExpected:\n%v;", tc.cmd, out, tc.out)
+			}
+		})
+	}
+}
+
+func equal(err, expected string) bool {
+	return err == expected
+}
+
+// tempDir creates a temporary directory with the files. The returned
+// function changes back to the current directory and removes it.
+func tempDir(t *testing.T, files map[string]string) (string, func()) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "casper")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFiles(t, dir, files)
+
+	return dir, func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+// writeFiles writes the files in the directory and creates their parent
+// directories. The files are executable so they can be used by exec sources.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 // Runs a function and returns the stdout from it.
 func getStdout(t *testing.T, f func()) string {
 	old := os.Stdout // keep backup of the real stdout
@@ -1,15 +1,37 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/miracl/casper/consul"
 	"github.com/miracl/casper/source"
 	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
 )
 
-const configScheme = "config"
+const (
+	configScheme = "config"
+	stdinScheme  = "stdin"
+)
+
+// defaultStdinFormat is used when the format of the stdin source is not set.
+// JSON documents are parsed by it too.
+const defaultStdinFormat = "yaml"
+
+// Defaults for the exec source.
+const (
+	defaultExecFormat  = "yaml"
+	defaultExecTimeout = 30 * time.Second
+)
 
 type getSourcer func(u *url.URL) (*source.Source, error)
 
@@ -26,21 +48,296 @@ func getConfigSource(u *url.URL) (*source.Source, error) {
 	return source.NewSource(body), nil
 }
 
+// getFileSource returns source with the content of a file. If the path is a
+// glob pattern all matching files are merged in lexical order. The format is
+// taken from the extension unless it is set with the format query parameter.
 func getFileSource(u *url.URL) (*source.Source, error) {
+	path := u.Hostname() + u.Path
+	format := u.Query().Get("format")
+
+	if !strings.ContainsAny(path, "*?[") {
+		return openFileSource(path, format)
+	}
+
+	paths, err := filepath.Glob(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "matching files %v failed", path)
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no files match %v", path)
+	}
+
+	return openFileSources(paths, format)
+}
+
+// getDirSource returns source with the files in a directory and its
+// subdirectories merged in lexical order. Only the files with supported
+// extension are used unless the format is set with the format query
+// parameter.
+func getDirSource(u *url.URL) (*source.Source, error) {
+	dir := u.Hostname() + u.Path
+	format := u.Query().Get("format")
+
+	paths := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() && (format != "" || fileFormat(path) != "") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading directory %v failed", dir)
+	}
 
-	path := u.Hostname() + u.EscapedPath()
-	pathSlice := strings.Split(path, ".")
-	format := pathSlice[len(pathSlice)-1]
+	return openFileSources(paths, format)
+}
 
-	r, err := os.Open(path)
+func openFileSources(paths []string, format string) (*source.Source, error) {
+	sources := make([]source.Getter, len(paths))
+	for i, path := range paths {
+		s, err := openFileSource(path, format)
+		if err != nil {
+			return nil, err
+		}
+		sources[i] = source.WithOrigin(s, "file://"+path)
+	}
+
+	return source.NewMultiSourcer(sources...)
+}
+
+func openFileSource(path, format string) (*source.Source, error) {
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, errors.Wrapf(err, "opening file %v failed", path)
 	}
 
-	s, err := source.NewFileSource(r, format)
+	if (format == "json" || format == "yaml" || format == "yml") && source.IsSOPS(data) {
+		s, err := source.NewSOPSSource(bytes.NewReader(data), format)
+		return s, errors.Wrapf(err, "creating new sops source %v failed", path)
+	}
+
+	s, err := source.NewFileSource(bytes.NewReader(data), format)
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating new file source %v failed", path)
+	}
+
+	return s, nil
+}
+
+// fileFormat returns the format of the file from the extension or empty
+// string if the format is not supported.
+func fileFormat(path string) string {
+	switch ext := strings.TrimPrefix(filepath.Ext(path), "."); ext {
+	case "json", "yaml", "yml", "toml", "hcl", "ini", "env":
+		return ext
+	}
+	return ""
+}
+
+func getEnvSource(u *url.URL) (*source.Source, error) {
+	q := u.Query()
+
+	lower := false
+	if l := q.Get("lower"); l != "" {
+		var err error
+		lower, err = strconv.ParseBool(l)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing lower %v failed", l)
+		}
+	}
+
+	s, err := source.NewEnvSource(os.Environ(), q.Get("prefix"), q.Get("sep"), lower)
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating new env source %v failed", u)
+	}
+
+	return s, nil
+}
+
+// getStdinSource returns source with the document from the standard input,
+// e.g. stdin://?format=json. The standard input can be read only once.
+func (c *context) getStdinSource(u *url.URL) (*source.Source, error) {
+	if c.stdin {
+		return nil, errors.New("stdin can be used only once as a source")
+	}
+	c.stdin = true
+
+	format := u.Query().Get("format")
+	if format == "" {
+		format = defaultStdinFormat
+	}
+
+	s, err := source.NewFileSource(os.Stdin, format)
+	return s, errors.Wrap(err, "reading source from stdin failed")
+}
+
+// usesStdin reports whether any of the sources reads the standard input.
+func usesStdin(sources []string) bool {
+	for _, s := range sources {
+		if s == "-" || strings.HasPrefix(s, stdinScheme+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// getConsulSource returns source with the key/value pairs of a Consul folder,
+// e.g. consul://127.0.0.1:8500/service?token=aclToken&scheme=https&lists=json.
+func getConsulSource(u *url.URL) (*source.Source, error) {
+	scheme := u.Query().Get("scheme")
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	client, err := consul.NewClient(&url.URL{Scheme: scheme, Host: u.Host, RawQuery: u.RawQuery})
+	if err != nil {
+		return nil, err
+	}
+
+	lists, err := consul.ParseListMode(u.Query().Get("lists"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing consul source %v failed", u.Host+u.Path)
+	}
+
+	prefix := strings.Trim(u.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	s, err := source.NewConsulSource(client.KV(), prefix, lists)
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating new consul source %v failed", u.Host+u.Path)
+	}
+
+	return s, nil
+}
+
+// getHTTPSource returns source with the json or yaml document from the url.
+// The sha256 and cache query parameters are used by casper and are not sent
+// to the server.
+func getHTTPSource(u *url.URL) (*source.Source, error) {
+	q := u.Query()
+	checksum := q.Get("sha256")
+
+	cacheDir := ""
+	if c := q.Get("cache"); c == "" || c == "true" {
+		if dir, err := os.UserCacheDir(); err == nil {
+			cacheDir = filepath.Join(dir, "casper", "http")
+		}
+	}
+
+	q.Del("sha256")
+	q.Del("cache")
+	fetchURL := *u
+	fetchURL.RawQuery = q.Encode()
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	s, cached, err := source.NewHTTPSource(client, fetchURL.String(), checksum, cacheDir)
 	if err != nil {
-		return nil, errors.Wrapf(err, "creating new file source %v failed", u)
+		return nil, errors.Wrapf(err, "creating new http source %v failed", fetchURL.Redacted())
+	}
+
+	if cached {
+		fmt.Fprintf(os.Stderr, "Warning: %v can't be reached, using cached copy\n", fetchURL.Redacted())
 	}
 
 	return s, nil
 }
+
+// getExecSource returns source with the output of a command, e.g.
+// exec://./values.sh?arg=production&format=json&timeout=10s. The command must
+// be allowed in the config file.
+func (c *context) getExecSource(u *url.URL) (*source.Source, error) {
+	name, err := commandPath(u.Host + u.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := c.allowedCommands()
+	if err != nil {
+		return nil, err
+	}
+
+	if !contains(allowed, name) {
+		return nil, fmt.Errorf("command %v is not allowed, add it to allow-exec in the config file", name)
+	}
+
+	q := u.Query()
+
+	format := q.Get("format")
+	if format == "" {
+		format = defaultExecFormat
+	}
+
+	timeout := defaultExecTimeout
+	if t := q.Get("timeout"); t != "" {
+		timeout, err = time.ParseDuration(t)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing timeout %v failed", t)
+		}
+	}
+
+	return source.NewExecSource(name, q["arg"], format, timeout)
+}
+
+// allowedCommands returns the commands that exec sources can run. They are
+// read only from allow-exec in the config file, so exec sources can't be
+// enabled with flags or environment variables.
+func (c *context) allowedCommands() ([]string, error) {
+	data, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading config %v failed", c.path)
+	}
+
+	config := struct {
+		AllowExec []string `yaml:"allow-exec"`
+	}{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, errors.Wrapf(err, "parsing config %v failed", c.path)
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(c.path))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, cmd := range config.AllowExec {
+		if strings.Contains(cmd, "/") && !filepath.IsAbs(cmd) {
+			config.AllowExec[i] = filepath.Join(dir, cmd)
+		}
+	}
+
+	return config.AllowExec, nil
+}
+
+// commandPath returns the absolute path of the command if it is a path.
+// Commands from PATH are returned as they are.
+func commandPath(name string) (string, error) {
+	if !strings.Contains(name, "/") {
+		return name, nil
+	}
+
+	path, err := filepath.Abs(name)
+	return path, errors.Wrapf(err, "resolving absolute path for command %v failed", name)
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
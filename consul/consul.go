@@ -2,12 +2,15 @@
 package consul
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 
 	"github.com/hashicorp/consul/api"
+	"github.com/miracl/casper/diff"
 	"github.com/pkg/errors"
 	yaml "gopkg.in/yaml.v2"
 )
@@ -22,6 +25,42 @@ const (
 	ConsulRemove
 )
 
+// ListMode is the way lists are stored as key/value pairs. The pairs don't
+// keep the types, so some values are read back differently. This only
+// affects the reading, the pairs still match the config they were stored
+// from.
+type ListMode int
+
+// List modes for flattening.
+const (
+	// IndexedLists stores each item under its index, e.g. servers/0. An
+	// empty list is stored as an empty value like null and a map with keys
+	// 0..n-1 is read back as a list.
+	IndexedLists ListMode = iota
+	// JSONLists stores the list as a JSON array in one key. A string with
+	// a JSON array is read back as a list.
+	JSONLists
+	// JoinedLists stores the items joined with listSep in one key. The
+	// joined lists are read back as strings.
+	JoinedLists
+)
+
+const listSep = ","
+
+// ParseListMode returns the list mode with the name. The default is
+// IndexedLists.
+func ParseListMode(s string) (ListMode, error) {
+	switch s {
+	case "", "indexed":
+		return IndexedLists, nil
+	case "json":
+		return JSONLists, nil
+	case "join":
+		return JoinedLists, nil
+	}
+	return IndexedLists, fmt.Errorf("invalid list mode '%v'", s)
+}
+
 // Change represents single Consul change.
 type Change struct {
 	Action Action
@@ -30,18 +69,33 @@ type Change struct {
 	NewVal string
 }
 
-// KVPairsToMap creates NestedMap from Consul KVPairs.
-func KVPairsToMap(pairs api.KVPairs) NestedMap {
+// NewClient returns Consul client for the address. The ACL token is taken
+// from the token query parameter.
+func NewClient(addr *url.URL) (*api.Client, error) {
+	cfg := &api.Config{
+		Address: addr.Host,
+		Scheme:  addr.Scheme,
+		Token:   addr.Query().Get("token"),
+	}
+
+	client, err := api.NewClient(cfg)
+	return client, errors.Wrap(err, "creating Consul client failed")
+}
+
+// KVPairsToMap creates NestedMap from Consul KVPairs. The values stored
+// with the list mode are converted back to lists.
+func KVPairsToMap(pairs api.KVPairs, lists ListMode) NestedMap {
 	j := NestedMap{}
 	for _, p := range pairs {
 		j.Add(p.Key, string(p.Value))
 	}
+	j.fromLists(lists)
 	return j
 }
 
 // GetChanges creates collection of changes from Consul KVPairs.
-func GetChanges(pairs api.KVPairs, config []byte, format string) ([]Change, error) {
-	kv, err := stringToMap(config, format)
+func GetChanges(pairs api.KVPairs, config []byte, format string, lists ListMode) ([]Change, error) {
+	kv, err := stringToMap(config, format, lists)
 	if err != nil {
 		return nil, err
 	}
@@ -79,7 +133,96 @@ func GetChanges(pairs api.KVPairs, config []byte, format string) ([]Change, erro
 	return changes, nil
 }
 
-func stringToMap(config []byte, format string) (map[string]string, error) {
+// KVChanges creates key/value changes from Consul KVPairs. Keys with value
+// ignoreVal and everything under them are skipped. If key is not empty only
+// the change for that key is returned.
+func KVChanges(pairs api.KVPairs, config []byte, format, key, ignoreVal string, lists ListMode) (diff.KVChanges, error) {
+	consulChanges, err := GetChanges(pairs, config, format, lists)
+	if err != nil {
+		return nil, err
+	}
+
+	ignoredPaths := []string{}
+	kvChanges := diff.KVChanges{}
+	for _, c := range consulChanges {
+		// skip ignored pairs
+		if ignoreVal != "" && c.NewVal == ignoreVal {
+			ignoredPaths = append(ignoredPaths, c.Key)
+			continue
+		}
+
+		if key != "" && key != c.Key {
+			continue
+		}
+
+		switch c.Action {
+		case ConsulAdd:
+			kvChanges = append(kvChanges, diff.NewAdd(c.Key, c.NewVal))
+		case ConsulRemove:
+			kvChanges = append(kvChanges, diff.NewRemove(c.Key, c.Val))
+		case ConsulUpdate:
+			kvChanges = append(kvChanges, diff.NewUpdate(c.Key, c.Val, c.NewVal))
+		}
+	}
+
+	// check for ignored folders
+	notIgnoreChanges := diff.KVChanges{}
+	for _, c := range kvChanges {
+		if isPathIgnored(c.Key(), ignoredPaths) {
+			continue
+		}
+		notIgnoreChanges = append(notIgnoreChanges, c)
+	}
+
+	return notIgnoreChanges, nil
+}
+
+func isPathIgnored(path string, ignoredPaths []string) bool {
+	for _, p := range ignoredPaths {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigChanges returns the key/value changes between the old and the new
+// config. Empty old config has no keys.
+func ConfigChanges(old, config []byte, format string, lists ListMode) (diff.KVChanges, error) {
+	pairs := api.KVPairs{}
+	if len(bytes.TrimSpace(old)) != 0 {
+		flat, err := GetChanges(nil, old, format, lists)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range flat {
+			pairs = append(pairs, &api.KVPair{Key: c.Key, Value: []byte(c.NewVal)})
+		}
+	}
+
+	return KVChanges(pairs, config, format, "", "", lists)
+}
+
+// KVPairsToString returns the Consul KVPairs as nested structure serialized
+// in format.
+func KVPairsToString(pairs api.KVPairs, format string, lists ListMode) string {
+	j := KVPairsToMap(pairs, lists)
+
+	var res []byte
+	switch format {
+	case "json":
+		res, _ = json.MarshalIndent(j, "", "  ")
+	case "jsonraw":
+		res, _ = json.Marshal(j)
+	default:
+		res, _ = yaml.Marshal(j)
+	}
+
+	return string(res)
+}
+
+func stringToMap(config []byte, format string, lists ListMode) (map[string]string, error) {
 	j := &map[string]interface{}{}
 	switch format {
 	case "json":
@@ -95,50 +238,144 @@ func stringToMap(config []byte, format string) (map[string]string, error) {
 	}
 
 	kv := map[string]string{}
-	if err := flatten(*j, []string{}, &kv); err != nil {
+	if err := flatten(*j, []string{}, &kv, lists); err != nil {
 		return nil, err
 	}
 	return kv, nil
 }
 
-func flatten(pairs map[string]interface{}, prefixes []string, kv *map[string]string) error {
+func flatten(pairs map[string]interface{}, prefixes []string, kv *map[string]string, lists ListMode) error {
 	for k, v := range pairs {
-		switch val := v.(type) {
-		case string:
-			if k == "_value" {
-				k = ""
-			}
-			(*kv)[strings.Join(append(prefixes, k), "/")] = val
-		case float64:
-			if k == "_value" {
-				k = ""
-			}
-			(*kv)[strings.Join(append(prefixes, k), "/")] = strconv.FormatFloat(val, 'f', -1, 64)
-		case bool:
-			if k == "_value" {
-				k = ""
-			}
-			(*kv)[strings.Join(append(prefixes, k), "/")] = strconv.FormatBool(val)
-		case map[string]interface{}:
-			if err := flatten(val, append(prefixes, k), kv); err != nil {
-				return err
-			}
-		case map[interface{}]interface{}:
-			pairs := map[string]interface{}{}
-			for ki, vi := range val {
-				key, ok := ki.(string)
-				if !ok {
-					return fmt.Errorf("key %#v not convertible to string", ki)
-				}
-				pairs[key] = vi
+		if err := flattenValue(v, append(prefixes, k), kv, lists); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func flattenValue(v interface{}, path []string, kv *map[string]string, lists ListMode) error {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return flatten(val, path, kv, lists)
+	case map[interface{}]interface{}:
+		pairs, err := stringKeys(val)
+		if err != nil {
+			return err
+		}
+		return flatten(pairs, path, kv, lists)
+	case []interface{}:
+		return flattenList(val, path, kv, lists)
+	}
+
+	str, ok := scalar(v)
+	if !ok {
+		key := strings.Join(path, ".")
+		return fmt.Errorf("type of the value of key %v:%#v not supported", key, v)
+	}
+
+	store(path, str, kv)
+	return nil
+}
+
+func flattenList(list []interface{}, path []string, kv *map[string]string, lists ListMode) error {
+	switch lists {
+	case JSONLists:
+		data, err := json.Marshal(normalize(list))
+		if err != nil {
+			return errors.Wrapf(err, "encoding list of key %v failed", strings.Join(path, "."))
+		}
+		store(path, string(data), kv)
+	case JoinedLists:
+		items := make([]string, len(list))
+		for i, item := range list {
+			str, ok := scalar(item)
+			if !ok {
+				return fmt.Errorf("list of key %v can't be joined, item %#v is not a value", strings.Join(path, "."), item)
 			}
-			if err := flatten(pairs, append(prefixes, k), kv); err != nil {
+			items[i] = str
+		}
+		store(path, strings.Join(items, listSep), kv)
+	default:
+		if len(list) == 0 {
+			store(path, "", kv)
+		}
+		for i, item := range list {
+			if err := flattenValue(item, append(path[:len(path):len(path)], strconv.Itoa(i)), kv, lists); err != nil {
 				return err
 			}
-		default:
-			key := strings.Join(append(prefixes, k), ".")
-			return fmt.Errorf("type of the value of key %v:%#v not supported", key, v)
 		}
 	}
 	return nil
 }
+
+// store sets the value of the key with the path. The value of a folder is
+// stored in the folder key.
+func store(path []string, value string, kv *map[string]string) {
+	key := path
+	if path[len(path)-1] == folderValKey {
+		key = append(path[:len(path)-1:len(path)-1], "")
+	}
+	(*kv)[strings.Join(key, keySep)] = value
+}
+
+// scalar returns the value as a string if it is not a map or a list. Null
+// is an empty string.
+func scalar(v interface{}) (string, bool) {
+	switch val := v.(type) {
+	case nil:
+		return "", true
+	case string:
+		return val, true
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(val), true
+	case int:
+		return strconv.Itoa(val), true
+	case int64:
+		return strconv.FormatInt(val, 10), true
+	case uint:
+		return strconv.FormatUint(uint64(val), 10), true
+	case uint64:
+		return strconv.FormatUint(val, 10), true
+	}
+	return "", false
+}
+
+func stringKeys(m map[interface{}]interface{}) (map[string]interface{}, error) {
+	pairs := map[string]interface{}{}
+	for ki, vi := range m {
+		key, ok := ki.(string)
+		if !ok {
+			return nil, fmt.Errorf("key %#v not convertible to string", ki)
+		}
+		pairs[key] = vi
+	}
+	return pairs, nil
+}
+
+// normalize converts the yaml maps in v to maps with string keys so it can
+// be encoded to json.
+func normalize(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, vi := range val {
+			m[fmt.Sprint(k)] = normalize(vi)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, vi := range val {
+			m[k] = normalize(vi)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(val))
+		for i, vi := range val {
+			l[i] = normalize(vi)
+		}
+		return l
+	}
+	return v
+}
@@ -5,9 +5,11 @@ import (
 	"flag"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/consul/api"
+	"github.com/miracl/casper/diff"
 )
 
 // It is defined in each package so you can run `go test ./...`
@@ -62,7 +64,7 @@ func TestConsulToMap(t *testing.T) {
 
 	for i, tc := range testCases {
 		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
-			got, _ := json.MarshalIndent(KVPairsToMap(tc.pairs), "", "  ")
+			got, _ := json.MarshalIndent(KVPairsToMap(tc.pairs, IndexedLists), "", "  ")
 			want, _ := json.MarshalIndent(tc.json, "", "  ")
 
 			if string(got) != string(want) {
@@ -126,7 +128,7 @@ func TestGetChanges(t *testing.T) {
 
 	for i, tc := range testCases {
 		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
-			changes, err := GetChanges(tc.pairs, tc.config, tc.format)
+			changes, err := GetChanges(tc.pairs, tc.config, tc.format, IndexedLists)
 
 			if tc.ok != (err == nil) {
 				if err != nil {
@@ -180,7 +182,7 @@ func TestStringToMap(t *testing.T) {
 		isOk   bool
 	}{
 		{[]byte(""), "json", nil, false},
-		{[]byte(`{"key1": {"_value": ["val1.1", "val1.2"]}}`), "json", nil, false},
+		{[]byte("key1:\n  1: val1"), "yaml", nil, false},
 		{
 			[]byte(`
                 key1: val1
@@ -282,7 +284,7 @@ func TestStringToMap(t *testing.T) {
 
 	for i, tc := range testCases {
 		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
-			pairs, err := stringToMap(tc.config, tc.format)
+			pairs, err := stringToMap(tc.config, tc.format, IndexedLists)
 			if err != nil {
 				if tc.isOk {
 					t.Fatalf("Got error %v", err)
@@ -300,3 +302,387 @@ func TestStringToMap(t *testing.T) {
 		})
 	}
 }
+
+func TestStringToMapTypes(t *testing.T) {
+	config := []byte(`
+port: 8080
+big: 18446744073709551615
+neg: -1
+ratio: 0.5
+empty: null
+servers: [a.example.com, b.example.com]
+nested:
+  - name: a
+    ports: [1, 2]
+none: []
+`)
+
+	testCases := []struct {
+		lists ListMode
+		pairs map[string]string
+		err   string
+	}{
+		{
+			IndexedLists,
+			map[string]string{
+				"port": "8080", "big": "18446744073709551615", "neg": "-1", "ratio": "0.5", "empty": "",
+				"servers/0": "a.example.com", "servers/1": "b.example.com",
+				"nested/0/name": "a", "nested/0/ports/0": "1", "nested/0/ports/1": "2",
+				"none": "",
+			},
+			"",
+		},
+		{
+			JSONLists,
+			map[string]string{
+				"port": "8080", "big": "18446744073709551615", "neg": "-1", "ratio": "0.5", "empty": "",
+				"servers": `["a.example.com","b.example.com"]`,
+				"nested":  `[{"name":"a","ports":[1,2]}]`,
+				"none":    "[]",
+			},
+			"",
+		},
+		{JoinedLists, nil, "list of key nested can't be joined"},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			pairs, err := stringToMap(config, "yaml", tc.lists)
+			if (tc.err == "") != (err == nil) {
+				if err != nil {
+					t.Fatal(err)
+				} else {
+					t.Fatal("Got no error but should have")
+				}
+			}
+
+			if err != nil {
+				if !strings.HasPrefix(err.Error(), tc.err) {
+					t.Errorf("Got %v; want %v", err, tc.err)
+				}
+				return
+			}
+
+			if !reflect.DeepEqual(pairs, tc.pairs) {
+				t.Errorf("Got %v; want %v", pairs, tc.pairs)
+			}
+		})
+	}
+
+	joined, err := stringToMap([]byte("servers: [a, 1, true]\n"), "yaml", JoinedLists)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a,1,true"; joined["servers"] != want {
+		t.Errorf("Got %v; want %v", joined["servers"], want)
+	}
+}
+
+func TestListsRoundTrip(t *testing.T) {
+	config := "nested:\n- name: a\n  ports:\n  - 1\n  - 2\nports:\n  \"0\": zero\n  \"2\": two\nservers:\n- a.example.com\n- b.example.com\n"
+
+	for i, lists := range []ListMode{IndexedLists, JSONLists} {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			kv, err := stringToMap([]byte(config), "yaml", lists)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pairs := api.KVPairs{}
+			for k, v := range kv {
+				pairs = append(pairs, &api.KVPair{Key: k, Value: []byte(v)})
+			}
+
+			// the numbers in the lists are read as strings from the pairs
+			want := strings.Replace(strings.Replace(config, "- 1", `- "1"`, 1), "- 2", `- "2"`, 1)
+			if lists == JSONLists {
+				want = config
+			}
+
+			if out := KVPairsToString(pairs, "yaml", lists); out != want {
+				t.Errorf("Got %v; want %v", out, want)
+			}
+		})
+	}
+}
+
+// TestListsRoundTripLimits covers the values that are read back differently
+// from the stored pairs. The stored pairs still match the config so there
+// are no changes after a push.
+func TestListsRoundTripLimits(t *testing.T) {
+	testCases := []struct {
+		config string
+		lists  ListMode
+		read   string
+	}{
+		// empty list is stored as an empty value like null
+		{`{"l":[],"n":null}`, IndexedLists, `{"l":"","n":""}`},
+		// folder with keys 0..n-1 is read as a list
+		{`{"m":{"0":"a","1":"b"}}`, IndexedLists, `{"m":["a","b"]}`},
+		{`{"m":{"0":"a","1":"b"}}`, JSONLists, `{"m":{"0":"a","1":"b"}}`},
+		// string with a JSON array is read as a list
+		{`{"l":[],"s":"[1]"}`, JSONLists, `{"l":[],"s":[1]}`},
+		// joined lists are read as strings
+		{`{"l":["a","b"]}`, JoinedLists, `{"l":"a,b"}`},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			kv, err := stringToMap([]byte(tc.config), "json", tc.lists)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pairs := api.KVPairs{}
+			for k, v := range kv {
+				pairs = append(pairs, &api.KVPair{Key: k, Value: []byte(v)})
+			}
+
+			if out := KVPairsToString(pairs, "jsonraw", tc.lists); out != tc.read {
+				t.Errorf("Got %v; want %v", out, tc.read)
+			}
+
+			changes, err := GetChanges(pairs, []byte(tc.config), "json", tc.lists)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(changes) != 0 {
+				t.Errorf("Got changes %v; want none", changes)
+			}
+		})
+	}
+}
+
+func TestConfigChanges(t *testing.T) {
+	testCases := []struct {
+		old    string
+		config string
+		diff   string
+	}{
+		{"", `{"key":"val"}`, "+key=val\n"},
+		{`{"key":"val","db":{"host":"old"}}`, `{"key":"val","db":{"host":"new","port":5432}}`, "-db/host=old\n+db/host=new\n+db/port=5432\n"},
+		{`{"key":"val"}`, `{}`, "-key=val\n"},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			changes, err := ConfigChanges([]byte(tc.old), []byte(tc.config), "json", IndexedLists)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if d := diff.Diff(changes, false); d != tc.diff {
+				t.Errorf("Got `%v`; want `%v`", d, tc.diff)
+			}
+		})
+	}
+
+	if _, err := ConfigChanges([]byte("not json"), []byte(`{}`), "json", IndexedLists); err == nil {
+		t.Error("Should fail")
+	}
+}
+
+func TestParseListMode(t *testing.T) {
+	testCases := []struct {
+		name  string
+		lists ListMode
+		err   string
+	}{
+		{"", IndexedLists, ""},
+		{"indexed", IndexedLists, ""},
+		{"json", JSONLists, ""},
+		{"join", JoinedLists, ""},
+		{"csv", IndexedLists, "invalid list mode 'csv'"},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			lists, err := ParseListMode(tc.name)
+			if err != nil && err.Error() != tc.err {
+				t.Errorf("Got %v; want %v", err, tc.err)
+			}
+			if err == nil && tc.err != "" {
+				t.Errorf("Got no error; want %v", tc.err)
+			}
+			if lists != tc.lists {
+				t.Errorf("Got %v; want %v", lists, tc.lists)
+			}
+		})
+	}
+}
+
+func TestKVPairsToString(t *testing.T) {
+	testCases := []struct {
+		pairs  api.KVPairs
+		format string
+		out    string
+	}{
+		{nil, "jsonraw", "{}"},
+		{
+			api.KVPairs{
+				&api.KVPair{Key: "key1", Value: []byte("val1")},
+			},
+			"jsonraw", `{"key1":"val1"}`,
+		},
+		{
+			api.KVPairs{
+				&api.KVPair{Key: "key1", Value: []byte("val1")},
+			},
+			"json",
+			"" +
+				"{\n" +
+				`  "key1": "val1"` + "\n" +
+				"}",
+		},
+		{
+			api.KVPairs{
+				&api.KVPair{Key: "key1", Value: []byte("val1")},
+			},
+			"yaml",
+			"key1: val1\n",
+		},
+		{
+			api.KVPairs{
+				&api.KVPair{Key: "key1", Value: []byte("val1")},
+			},
+			"invalid",
+			"key1: val1\n",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			out := KVPairsToString(tc.pairs, tc.format, IndexedLists)
+			if out != tc.out {
+				t.Errorf("Got `%v`; want `%v`", out, tc.out)
+			}
+		})
+	}
+}
+
+func TestKVChanges(t *testing.T) {
+	testCases := []struct {
+		pairs  api.KVPairs
+		config string
+		format string
+		key    string
+		ch     diff.KVChanges
+		ok     bool
+	}{
+		{nil, "", "", "", nil, false},
+		{
+			api.KVPairs{
+				&api.KVPair{Key: "key1", Value: []byte("val1")},
+			},
+			`{"key1": "val1"}`, "json", "",
+			diff.KVChanges{},
+			true,
+		},
+		{
+			api.KVPairs{
+				&api.KVPair{Key: "key1", Value: []byte("val1")},
+			},
+			`{"key1": "val1", "key2": "val2"}`, "json", "",
+			diff.KVChanges{
+				diff.NewAdd("key2", "val2"),
+			},
+			true,
+		},
+		{
+			api.KVPairs{
+				&api.KVPair{Key: "key1", Value: []byte("val1")},
+				&api.KVPair{Key: "key2", Value: []byte("val2")},
+			},
+			`{"key1": "val1"}`, "json", "",
+			diff.KVChanges{
+				diff.NewRemove("key2", "val2"),
+			},
+			true,
+		},
+		{
+			api.KVPairs{
+				&api.KVPair{Key: "key1", Value: []byte("val1")},
+				&api.KVPair{Key: "key2", Value: []byte("val")},
+			},
+			`{"key1": "val1", "key2": "val2"}`, "json", "",
+			diff.KVChanges{
+				diff.NewUpdate("key2", "val", "val2"),
+			},
+			true,
+		},
+		{
+			api.KVPairs{
+				&api.KVPair{Key: "key", Value: []byte("val")},
+				&api.KVPair{Key: "key1", Value: []byte("val1")},
+				&api.KVPair{Key: "key2", Value: []byte("val")},
+			},
+			`{"key1": "val1", "key2": "val2", "key3": "val3"}`, "json", "",
+			diff.KVChanges{
+				diff.NewRemove("key", "val"),
+				diff.NewUpdate("key2", "val", "val2"),
+				diff.NewAdd("key3", "val3"),
+			},
+			true,
+		},
+		{
+			api.KVPairs{
+				&api.KVPair{Key: "key", Value: []byte("val")},
+				&api.KVPair{Key: "key1", Value: []byte("val1")},
+				&api.KVPair{Key: "key2", Value: []byte("val")},
+			},
+			`{"key1": "val1", "key2": "val2", "key3": "val3"}`, "json", "key2",
+			diff.KVChanges{
+				diff.NewUpdate("key2", "val", "val2"),
+			},
+			true,
+		},
+		{
+			api.KVPairs{
+				&api.KVPair{Key: "key1", Value: []byte("val1")},
+				&api.KVPair{Key: "key3/ignoredSubKey", Value: []byte("whatever")},
+				&api.KVPair{Key: "ignoredKey", Value: []byte("whatever")},
+				&api.KVPair{Key: "ignoredFolder/key1", Value: []byte("whatever")},
+				&api.KVPair{Key: "ignoredFolder/key2", Value: []byte("whatever")},
+			},
+			`{
+				"key1": "val1",
+				"key2": "val2",
+				"key3": {
+					"_value": "val3",
+					"ignoredSubKey": "_ignore",
+					"subKey": {
+						"_value": "_ignore",
+						"key3SubKey": "whatever"
+					}
+				},
+				"ignoredKey": "_ignore",
+				"ignoredFolder": "_ignore"
+			}`,
+			"json", "",
+			diff.KVChanges{
+				diff.NewAdd("key2", "val2"),
+				diff.NewAdd("key3/", "val3"),
+			},
+			true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			ch, err := KVChanges(tc.pairs, []byte(tc.config), tc.format, tc.key, "_ignore", IndexedLists)
+
+			if tc.ok != (err == nil) {
+				if err != nil {
+					t.Fatal(err)
+				} else {
+					t.Fatal("Get should have failed but haven't")
+				}
+			}
+
+			if tc.ok && diff.Diff(ch, false) != diff.Diff(tc.ch, false) {
+				t.Errorf("Got `%v`; want `%v`", ch, tc.ch)
+			}
+		})
+	}
+}
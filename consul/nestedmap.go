@@ -1,6 +1,10 @@
 package consul
 
-import "strings"
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
 
 var (
 	keySep       = "/"
@@ -68,3 +72,42 @@ func (j NestedMap) addPath(key, path, value string, isFolder bool) {
 	j[key] = n
 	return
 }
+
+// fromLists converts the values stored with the list mode back to lists.
+func (j NestedMap) fromLists(lists ListMode) {
+	for k, v := range j {
+		j[k] = fromList(v, lists)
+	}
+}
+
+func fromList(v interface{}, lists ListMode) interface{} {
+	switch val := v.(type) {
+	case NestedMap:
+		val.fromLists(lists)
+		if lists != IndexedLists {
+			return val
+		}
+
+		// folders with keys 0..n-1 are lists
+		list := make([]interface{}, len(val))
+		for k, vi := range val {
+			i, err := strconv.Atoi(k)
+			if err != nil || i < 0 || i >= len(list) || strconv.Itoa(i) != k {
+				return val
+			}
+			list[i] = vi
+		}
+		return list
+	case string:
+		if lists != JSONLists || !strings.HasPrefix(val, "[") {
+			return val
+		}
+
+		list := []interface{}{}
+		if err := json.Unmarshal([]byte(val), &list); err != nil {
+			return val
+		}
+		return list
+	}
+	return v
+}
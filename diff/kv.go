@@ -32,6 +32,12 @@ func (c KVChanges) Swap(i, j int) {
 	c[i], c[j] = c[j], c[i]
 }
 
+// KeyChanges returns the changes. The key/value changes are already listed
+// per key of the config.
+func (c KVChanges) KeyChanges() KVChanges {
+	return c
+}
+
 // Diff returns a visual representation of the changes.
 func Diff(changes KVChanges, pretty bool) string {
 	sort.Sort(changes)
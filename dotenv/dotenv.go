@@ -0,0 +1,250 @@
+// Package dotenv contains parsers and formatters for .env and Java
+// .properties files.
+package dotenv
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// safeEnvVal matches the values that can be written without quotes.
+var safeEnvVal = regexp.MustCompile(`^[A-Za-z0-9_./:@,+%-]*$`)
+
+var envEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// ParseEnv parses .env file. Lines can start with export, values can be
+// double quoted with escapes, single quoted or bare with # comments.
+func ParseEnv(data []byte) (map[string]string, error) {
+	vars := map[string]string{}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid line %v: %v", i+1, line)
+		}
+
+		key := strings.TrimSpace(kv[0])
+		val := strings.TrimSpace(kv[1])
+
+		switch {
+		case strings.HasPrefix(val, `"`):
+			end := closingQuote(val)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote on line %v", i+1)
+			}
+
+			var err error
+			val, err = strconv.Unquote(val[:end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid value on line %v: %v", i+1, err)
+			}
+		case strings.HasPrefix(val, "'"):
+			end := strings.Index(val[1:], "'")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote on line %v", i+1)
+			}
+			val = val[1 : end+1]
+		default:
+			if c := strings.Index(val, " #"); c >= 0 {
+				val = strings.TrimSpace(val[:c])
+			}
+		}
+
+		vars[key] = val
+	}
+
+	return vars, nil
+}
+
+// closingQuote returns the index of the double quote that closes the one at
+// the beginning of s or -1.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// FormatEnv returns .env file with the variables sorted by key.
+func FormatEnv(vars map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	for _, k := range sortedKeys(vars) {
+		v := vars[k]
+		if !safeEnvVal.MatchString(v) {
+			v = `"` + envEscaper.Replace(v) + `"`
+		}
+		fmt.Fprintf(buf, "%v=%v\n", k, v)
+	}
+	return buf.Bytes()
+}
+
+// ParseProperties parses Java .properties file as described in
+// java.util.Properties.load.
+func ParseProperties(data []byte) map[string]string {
+	vars := map[string]string{}
+
+	lines := strings.Split(strings.Replace(string(data), "\r\n", "\n", -1), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimLeft(lines[i], " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+
+		// join the continuation lines
+		for trailingBackslashes(line)%2 == 1 && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + strings.TrimLeft(lines[i], " \t\f")
+		}
+
+		// the key ends with the first not escaped separator
+		end := len(line)
+		for j := 0; j < len(line); j++ {
+			if line[j] == '\\' {
+				j++
+				continue
+			}
+			if strings.IndexByte("=: \t\f", line[j]) >= 0 {
+				end = j
+				break
+			}
+		}
+
+		val := strings.TrimLeft(line[end:], " \t\f")
+		if val != "" && (val[0] == '=' || val[0] == ':') {
+			val = strings.TrimLeft(val[1:], " \t\f")
+		}
+
+		vars[unescapeProperty(line[:end])] = unescapeProperty(val)
+	}
+
+	return vars
+}
+
+func trailingBackslashes(s string) int {
+	n := 0
+	for i := len(s) - 1; i >= 0 && s[i] == '\\'; i-- {
+		n++
+	}
+	return n
+}
+
+func unescapeProperty(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	res := []rune{}
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '\\' || i+1 == len(runes) {
+			res = append(res, runes[i])
+			continue
+		}
+
+		i++
+		switch runes[i] {
+		case 't':
+			res = append(res, '\t')
+		case 'n':
+			res = append(res, '\n')
+		case 'r':
+			res = append(res, '\r')
+		case 'f':
+			res = append(res, '\f')
+		case 'u':
+			if i+4 < len(runes) {
+				if r, err := strconv.ParseUint(string(runes[i+1:i+5]), 16, 16); err == nil {
+					res = append(res, rune(r))
+					i += 4
+					continue
+				}
+			}
+			res = append(res, 'u')
+		default:
+			res = append(res, runes[i])
+		}
+	}
+
+	// join the escaped surrogate pairs
+	return string(utf16.Decode(runesToUTF16(res)))
+}
+
+func runesToUTF16(runes []rune) []uint16 {
+	res := []uint16{}
+	for _, r := range runes {
+		if r < 0x10000 {
+			// keeps the escaped surrogates as they are
+			res = append(res, uint16(r))
+			continue
+		}
+		res = append(res, utf16.Encode([]rune{r})...)
+	}
+	return res
+}
+
+// FormatProperties returns .properties file with the variables sorted by
+// key. Non ASCII characters are escaped so the file can be read as
+// ISO 8859-1.
+func FormatProperties(vars map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	for _, k := range sortedKeys(vars) {
+		fmt.Fprintf(buf, "%v=%v\n", escapeProperty(k, true), escapeProperty(vars[k], false))
+	}
+	return buf.Bytes()
+}
+
+func escapeProperty(s string, isKey bool) string {
+	buf := &bytes.Buffer{}
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			buf.WriteString(`\\`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\f':
+			buf.WriteString(`\f`)
+		case r == ' ' && (isKey || i == 0):
+			buf.WriteString(`\ `)
+		case strings.ContainsRune("=:#!", r):
+			buf.WriteRune('\\')
+			buf.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			for _, u := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(buf, `\u%04x`, u)
+			}
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+func sortedKeys(vars map[string]string) []string {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
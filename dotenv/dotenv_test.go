@@ -0,0 +1,126 @@
+package dotenv
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseEnv(t *testing.T) {
+	testCases := []struct {
+		data string
+		vars map[string]string
+		ok   bool
+	}{
+		{"", map[string]string{}, true},
+		{
+			"# comment\n\nKEY1=val1\nexport KEY2 = val2 # comment\r\nKEY3=\n",
+			map[string]string{"KEY1": "val1", "KEY2": "val2", "KEY3": ""},
+			true,
+		},
+		{
+			`KEY1="val \"1\"\n#x" # comment` + "\n" + `KEY2='val $2 \n'`,
+			map[string]string{"KEY1": "val \"1\"\n#x", "KEY2": `val $2 \n`},
+			true,
+		},
+		{"KEY1", nil, false},
+		{`KEY1="val`, nil, false},
+		{`KEY1='val`, nil, false},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			vars, err := ParseEnv([]byte(tc.data))
+			if tc.ok != (err == nil) {
+				if err != nil {
+					t.Fatal(err)
+				} else {
+					t.Fatal("Should fail")
+				}
+			}
+
+			if tc.ok && !reflect.DeepEqual(vars, tc.vars) {
+				t.Errorf("Got %v; want %v", vars, tc.vars)
+			}
+		})
+	}
+}
+
+func TestFormatEnv(t *testing.T) {
+	vars := map[string]string{
+		"B_KEY": "http://host:80/path",
+		"A_KEY": "val with spaces",
+		"C_KEY": "multi\nline \"quoted\" $var",
+		"D_KEY": "",
+	}
+
+	exp := "" +
+		`A_KEY="val with spaces"` + "\n" +
+		`B_KEY=http://host:80/path` + "\n" +
+		`C_KEY="multi\nline \"quoted\" $var"` + "\n" +
+		`D_KEY=` + "\n"
+
+	data := FormatEnv(vars)
+	if string(data) != exp {
+		t.Errorf("Got `%s`; want `%v`", data, exp)
+	}
+
+	parsed, err := ParseEnv(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(parsed, vars) {
+		t.Errorf("Got %v; want %v", parsed, vars)
+	}
+}
+
+func TestParseProperties(t *testing.T) {
+	testCases := []struct {
+		data string
+		vars map[string]string
+	}{
+		{"", map[string]string{}},
+		{
+			"# comment\n! comment\n  key1 = val1\nkey2:val2\nkey3 val3\nkey4\n",
+			map[string]string{"key1": "val1", "key2": "val2", "key3": "val3", "key4": ""},
+		},
+		{
+			"key\\ 1\\=x = val\\tone\\\n    two\r\nkey2=\\u00e9\\ud83d\\ude00\\\\\n",
+			map[string]string{"key 1=x": "val\tonetwo", "key2": "é😀\\"},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			vars := ParseProperties([]byte(tc.data))
+			if !reflect.DeepEqual(vars, tc.vars) {
+				t.Errorf("Got %v; want %v", vars, tc.vars)
+			}
+		})
+	}
+}
+
+func TestFormatProperties(t *testing.T) {
+	vars := map[string]string{
+		"db.host":  "127.0.0.1",
+		"db.url":   "jdbc:postgres://host/db?a=b",
+		"key with": " spaces #!\n",
+		"unicode":  "é😀",
+	}
+
+	exp := "" +
+		`db.host=127.0.0.1` + "\n" +
+		`db.url=jdbc\:postgres\://host/db?a\=b` + "\n" +
+		`key\ with=\ spaces \#\!\n` + "\n" +
+		`unicode=\u00e9\ud83d\ude00` + "\n"
+
+	data := FormatProperties(vars)
+	if string(data) != exp {
+		t.Errorf("Got `%s`; want `%v`", data, exp)
+	}
+
+	if parsed := ParseProperties(data); !reflect.DeepEqual(parsed, vars) {
+		t.Errorf("Got %v; want %v", parsed, vars)
+	}
+}
@@ -8,11 +8,15 @@ type Getter interface {
 // Source is a simple ValuesSourcer implementation.
 type Source struct {
 	body map[string]interface{}
+	data []byte                 // the parsed document if any
+	prov map[string]*Provenance // set by NewMultiSourcer
+	// the keys of the decrypted values joined with dots
+	secrets map[string]bool
 }
 
 // NewSource creates new Source.
 func NewSource(body map[string]interface{}) *Source {
-	return &Source{body}
+	return &Source{body: body}
 }
 
 // Get returns the values from the source.
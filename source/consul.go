@@ -0,0 +1,61 @@
+package source
+
+import (
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/miracl/casper/consul"
+	"github.com/pkg/errors"
+)
+
+// ConsulKV is interface that Consul KV type implements.
+type ConsulKV interface {
+	List(prefix string, q *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error)
+}
+
+// NewConsulSource creates new source from the Consul key/value pairs under
+// prefix. The prefix is removed from the keys and the nested keys become
+// nested values. The values stored with the list mode become lists.
+func NewConsulSource(kv ConsulKV, prefix string, lists consul.ListMode) (*Source, error) {
+	pairs, _, err := kv.List(prefix, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting key/value pairs under '%v' from Consul failed", prefix)
+	}
+
+	trimmed := api.KVPairs{}
+	for _, p := range pairs {
+		key := strings.TrimPrefix(p.Key, prefix)
+		key = strings.TrimPrefix(key, "/")
+		if key == "" {
+			// the prefix folder itself
+			continue
+		}
+		trimmed = append(trimmed, &api.KVPair{Key: key, Value: p.Value})
+	}
+
+	return NewSource(toMap(consul.KVPairsToMap(trimmed, lists))), nil
+}
+
+// toMap converts consul.NestedMap to plain nested maps.
+func toMap(n consul.NestedMap) map[string]interface{} {
+	m := map[string]interface{}{}
+	for k, v := range n {
+		m[k] = toPlain(v)
+	}
+	return m
+}
+
+// toPlain converts the consul.NestedMap values in v to plain maps.
+func toPlain(v interface{}) interface{} {
+	switch val := v.(type) {
+	case consul.NestedMap:
+		return toMap(val)
+	case []interface{}:
+		list := make([]interface{}, len(val))
+		for i, vi := range val {
+			list[i] = toPlain(vi)
+		}
+		return list
+	}
+	return v
+}
@@ -0,0 +1,103 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/miracl/casper/consul"
+)
+
+type kvMock struct {
+	list    api.KVPairs
+	listErr error
+}
+
+func (kv *kvMock) List(prefix string, q *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error) {
+	pairs := api.KVPairs{}
+	for _, p := range kv.list {
+		if strings.HasPrefix(p.Key, prefix) {
+			pairs = append(pairs, p)
+		}
+	}
+	return pairs, nil, kv.listErr
+}
+
+func TestConsulSourcer(t *testing.T) {
+	list := api.KVPairs{
+		&api.KVPair{Key: "team/", Value: []byte("")},
+		&api.KVPair{Key: "team/key1", Value: []byte("val1")},
+		&api.KVPair{Key: "team/db/", Value: []byte("main")},
+		&api.KVPair{Key: "team/db/host", Value: []byte("host")},
+		&api.KVPair{Key: "other/key", Value: []byte("val")},
+	}
+
+	testCases := []struct {
+		listErr error
+		prefix  string
+		parsed  map[string]interface{}
+		ok      bool
+	}{
+		{
+			nil, "team/",
+			map[string]interface{}{
+				"key1": "val1",
+				"db": map[string]interface{}{
+					"_value": "main",
+					"host":   "host",
+				},
+			},
+			true,
+		},
+		{
+			nil, "team",
+			map[string]interface{}{
+				"key1": "val1",
+				"db": map[string]interface{}{
+					"_value": "main",
+					"host":   "host",
+				},
+			},
+			true,
+		},
+		{
+			nil, "",
+			map[string]interface{}{
+				"team": map[string]interface{}{
+					"_value": "",
+					"key1":   "val1",
+					"db": map[string]interface{}{
+						"_value": "main",
+						"host":   "host",
+					},
+				},
+				"other": map[string]interface{}{
+					"key": "val",
+				},
+			},
+			true,
+		},
+		{nil, "missing/", map[string]interface{}{}, true},
+		{errors.New("list failed"), "team/", nil, false},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			s, err := NewConsulSource(&kvMock{list, tc.listErr}, tc.prefix, consul.IndexedLists)
+			if tc.ok != (err == nil) {
+				if err != nil {
+					t.Fatal(err)
+				} else {
+					t.Fatal("Get should have failed but haven't")
+				}
+			}
+
+			if tc.ok && !reflect.DeepEqual(s.Get(), tc.parsed) {
+				t.Errorf("Got %v; want %v", s.Get(), tc.parsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package source
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NewEnvSource creates new source from environment variables in the form
+// key=value as returned by os.Environ. Only the variables starting with
+// prefix are used and the prefix is removed from the keys. If lower is set
+// the keys are lower-cased. If sep is not empty the keys are split on it
+// into nested values, e.g. DB__HOST becomes {"DB": {"HOST": ...}} for sep
+// "__".
+func NewEnvSource(environ []string, prefix, sep string, lower bool) (*Source, error) {
+	body := map[string]interface{}{}
+
+	for _, e := range environ {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 || !strings.HasPrefix(kv[0], prefix) {
+			continue
+		}
+
+		key := strings.TrimPrefix(kv[0], prefix)
+		if key == "" {
+			continue
+		}
+
+		if lower {
+			key = strings.ToLower(key)
+		}
+
+		path := []string{key}
+		if sep != "" {
+			path = strings.Split(key, sep)
+		}
+
+		if err := setNested(body, path, kv[1]); err != nil {
+			return nil, fmt.Errorf("environment variable %v: %v", kv[0], err)
+		}
+	}
+
+	return NewSource(body), nil
+}
+
+// setNested sets the value in the nested maps creating the missing ones.
+func setNested(body map[string]interface{}, path []string, val interface{}) error {
+	for i, k := range path[:len(path)-1] {
+		switch v := body[k].(type) {
+		case nil:
+			next := map[string]interface{}{}
+			body[k] = next
+			body = next
+		case map[string]interface{}:
+			body = v
+		default:
+			return fmt.Errorf("%v is already set to a value", strings.Join(path[:i+1], "."))
+		}
+	}
+
+	last := path[len(path)-1]
+	if _, ok := body[last].(map[string]interface{}); ok {
+		return fmt.Errorf("%v is already set to nested values", strings.Join(path, "."))
+	}
+
+	body[last] = val
+	return nil
+}
@@ -0,0 +1,82 @@
+package source
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestEnvSourcer(t *testing.T) {
+	environ := []string{
+		"APP_KEY1=val1",
+		"APP_DB__HOST=host",
+		"APP_DB__PORT=5432",
+		"APP_=empty",
+		"APP_URL=http://host/?a=b",
+		"OTHER=val",
+		"INVALID",
+	}
+
+	testCases := []struct {
+		environ []string
+		prefix  string
+		sep     string
+		lower   bool
+		parsed  map[string]interface{}
+		ok      bool
+	}{
+		{
+			environ, "APP_", "", false,
+			map[string]interface{}{
+				"KEY1":     "val1",
+				"DB__HOST": "host",
+				"DB__PORT": "5432",
+				"URL":      "http://host/?a=b",
+			},
+			true,
+		},
+		{
+			environ, "APP_", "__", true,
+			map[string]interface{}{
+				"key1": "val1",
+				"db": map[string]interface{}{
+					"host": "host",
+					"port": "5432",
+				},
+				"url": "http://host/?a=b",
+			},
+			true,
+		},
+		{
+			environ, "OTH", "", false,
+			map[string]interface{}{"ER": "val"},
+			true,
+		},
+		{
+			[]string{"A=val", "A__B=val"}, "", "__", false, nil, false,
+		},
+		{
+			[]string{"A__B=val", "A=val"}, "", "__", false, nil, false,
+		},
+		{
+			[]string{"A__B__C=val", "A__B=val"}, "", "__", false, nil, false,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			s, err := NewEnvSource(tc.environ, tc.prefix, tc.sep, tc.lower)
+			if tc.ok != (err == nil) {
+				if err != nil {
+					t.Fatal(err)
+				} else {
+					t.Fatal("Get should have failed but haven't")
+				}
+			}
+
+			if tc.ok && !reflect.DeepEqual(s.Get(), tc.parsed) {
+				t.Errorf("Got %v; want %v", s.Get(), tc.parsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NewExecSource creates new source from the output of a command. The
+// command is killed if it doesn't finish in timeout. The stdout is parsed in
+// format and the stderr is returned in the error if the command fails.
+func NewExecSource(name string, args []string, format string, timeout time.Duration) (*Source, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// don't wait for the children of the command that keep the output open
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("command %v timed out after %v", name, timeout)
+		}
+		return nil, fmt.Errorf("command %v failed: %v: %v", name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	s, err := NewFileSource(stdout, format)
+	return s, errors.Wrapf(err, "parsing output of command %v failed", name)
+}
@@ -0,0 +1,62 @@
+package source
+
+import (
+	"fmt"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecSourcer(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+
+	testCases := []struct {
+		script  string
+		format  string
+		timeout time.Duration
+		parsed  map[string]interface{}
+		err     string
+	}{
+		{
+			`echo '{"key1":"val1","key2":"val2"}'`, "json", time.Second,
+			map[string]interface{}{"key1": "val1", "key2": "val2"},
+			"",
+		},
+		{
+			`printf 'key1: val1\nkey2: val2\n'; echo warning >&2`, "yaml", time.Second,
+			map[string]interface{}{"key1": "val1", "key2": "val2"},
+			"",
+		},
+		{`echo 'not json'`, "json", time.Second, nil, "parsing output of command sh failed"},
+		{`echo '{}'; echo 'access denied' >&2; exit 3`, "json", time.Second, nil, "command sh failed: exit status 3: access denied"},
+		{`sleep 5`, "json", 50 * time.Millisecond, nil, "command sh timed out after 50ms"},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			s, err := NewExecSource("sh", []string{"-c", tc.script}, tc.format, tc.timeout)
+			if (tc.err == "") != (err == nil) {
+				if err != nil {
+					t.Fatal(err)
+				} else {
+					t.Fatal("Get should have failed but haven't")
+				}
+			}
+
+			if err != nil {
+				if !strings.HasPrefix(err.Error(), tc.err) {
+					t.Errorf("Got %v; want %v", err, tc.err)
+				}
+				return
+			}
+
+			if !reflect.DeepEqual(s.Get(), tc.parsed) {
+				t.Errorf("Got %v; want %v", s.Get(), tc.parsed)
+			}
+		})
+	}
+}
@@ -5,12 +5,17 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"strings"
 
+	"github.com/BurntSushi/toml"
+	"github.com/hashicorp/hcl"
+	"github.com/miracl/casper/dotenv"
 	"github.com/pkg/errors"
 	yaml "gopkg.in/yaml.v2"
 )
 
-// NewFileSource creates new file source.
+// NewFileSource creates new file source. Supported formats are json, yaml
+// (yml), toml, hcl, ini and env.
 func NewFileSource(r io.Reader, format string) (*Source, error) {
 	if r == nil {
 		return &Source{}, nil
@@ -27,13 +32,121 @@ func NewFileSource(r io.Reader, format string) (*Source, error) {
 		if err := json.Unmarshal(data, &body); err != nil {
 			return nil, errors.Wrap(err, "parsing json failed")
 		}
-	case "yaml":
+	case "yaml", "yml":
 		if err := yaml.Unmarshal(data, &body); err != nil {
 			return nil, errors.Wrap(err, "parsing yaml failed")
 		}
+	case "toml":
+		if err := toml.Unmarshal(data, &body); err != nil {
+			return nil, errors.Wrap(err, "parsing toml failed")
+		}
+	case "hcl":
+		if err := hcl.Unmarshal(data, &body); err != nil {
+			return nil, errors.Wrap(err, "parsing hcl failed")
+		}
+		body = hclBlocks(body).(map[string]interface{})
+	case "ini":
+		var err error
+		if body, err = parseINI(data); err != nil {
+			return nil, errors.Wrap(err, "parsing ini failed")
+		}
+	case "env":
+		vars, err := dotenv.ParseEnv(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing env failed")
+		}
+		for k, v := range vars {
+			body[k] = v
+		}
 	default:
 		return nil, fmt.Errorf("unsupported file source format '%v'", format)
 	}
 
-	return NewSource(body), nil
+	return &Source{body: body, data: data}, nil
+}
+
+// hclBlocks converts the blocks that HCL decodes as lists of objects to
+// nested maps, e.g. `db { host = "h" }` to {"db": {"host": "h"}}. Repeated
+// blocks are merged.
+func hclBlocks(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, vi := range val {
+			val[k] = hclBlocks(vi)
+		}
+		return val
+	case []map[string]interface{}:
+		merged := map[string]interface{}{}
+		for _, m := range val {
+			for k, vi := range hclBlocks(m).(map[string]interface{}) {
+				if prev, ok := merged[k].(map[string]interface{}); ok {
+					if next, ok := vi.(map[string]interface{}); ok {
+						merged[k] = hclBlocks([]map[string]interface{}{prev, next})
+						continue
+					}
+				}
+				merged[k] = vi
+			}
+		}
+		return merged
+	case []interface{}:
+		for i, vi := range val {
+			val[i] = hclBlocks(vi)
+		}
+		return val
+	}
+	return v
+}
+
+// parseINI parses ini file. The keys before the first section are on the
+// top level and the sections are nested maps. Dots in the section names
+// create deeper levels, e.g. [db.replica].
+func parseINI(data []byte) (map[string]interface{}, error) {
+	body := map[string]interface{}{}
+	section := body
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("invalid section on line %v: %v", i+1, line)
+			}
+
+			section = body
+			for _, name := range strings.Split(strings.Trim(line, "[]"), ".") {
+				name = strings.TrimSpace(name)
+				next, ok := section[name].(map[string]interface{})
+				if !ok {
+					if _, exists := section[name]; exists {
+						return nil, fmt.Errorf("section %v on line %v is already a key", name, i+1)
+					}
+					next = map[string]interface{}{}
+					section[name] = next
+				}
+				section = next
+			}
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid line %v: %v", i+1, line)
+		}
+
+		key, val := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if len(val) > 1 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+			val = val[1 : len(val)-1]
+		}
+
+		if _, ok := section[key].(map[string]interface{}); ok {
+			return nil, fmt.Errorf("key %v on line %v is already a section", key, i+1)
+		}
+		section[key] = val
+	}
+
+	return body, nil
 }
@@ -63,6 +63,75 @@ func TestFileSourcer(t *testing.T) {
 		},
 		{nil, "json", nil, true},
 		{FailingReader{}, "json", nil, false},
+		{
+			bytes.NewBufferString("key1: var1\nkey2: var2\n"),
+			"yml",
+			map[string]interface{}{
+				"key1": "var1",
+				"key2": "var2",
+			},
+			true,
+		},
+		{
+			bytes.NewBufferString("key1 = \"var1\"\n\n[db]\nhost = \"host\"\nport = 5432\n"),
+			"toml",
+			map[string]interface{}{
+				"key1": "var1",
+				"db": map[string]interface{}{
+					"host": "host",
+					"port": int64(5432),
+				},
+			},
+			true,
+		},
+		{bytes.NewBufferString("key1 = var1"), "toml", nil, false},
+		{
+			bytes.NewBufferString("key1 = \"var1\"\ndb {\n  host = \"host\"\n}\ndb {\n  port = 5432\n  replica \"r1\" {\n    host = \"r1\"\n  }\n}\nlist = [\"a\", \"b\"]\n"),
+			"hcl",
+			map[string]interface{}{
+				"key1": "var1",
+				"db": map[string]interface{}{
+					"host": "host",
+					"port": 5432,
+					"replica": map[string]interface{}{
+						"r1": map[string]interface{}{
+							"host": "r1",
+						},
+					},
+				},
+				"list": []interface{}{"a", "b"},
+			},
+			true,
+		},
+		{bytes.NewBufferString("key1 = {"), "hcl", nil, false},
+		{
+			bytes.NewBufferString("; comment\nkey1 = var1\n\n[db]\nhost = \"host\"\n# comment\n[db.replica]\nhost = 'r1'\n"),
+			"ini",
+			map[string]interface{}{
+				"key1": "var1",
+				"db": map[string]interface{}{
+					"host": "host",
+					"replica": map[string]interface{}{
+						"host": "r1",
+					},
+				},
+			},
+			true,
+		},
+		{bytes.NewBufferString("[db\nhost = host"), "ini", nil, false},
+		{bytes.NewBufferString("host"), "ini", nil, false},
+		{bytes.NewBufferString("db = val\n[db]\nhost = host"), "ini", nil, false},
+		{bytes.NewBufferString("[db]\nhost = host\n[db.host]\nport = 1"), "ini", nil, false},
+		{
+			bytes.NewBufferString("# comment\nKEY1=var1\nexport KEY2=\"var 2\"\n"),
+			"env",
+			map[string]interface{}{
+				"KEY1": "var1",
+				"KEY2": "var 2",
+			},
+			true,
+		},
+		{bytes.NewBufferString("KEY1"), "env", nil, false},
 	}
 
 	for i, tc := range testCases {
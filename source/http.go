@@ -0,0 +1,197 @@
+package source
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// NewHTTPSource creates new source from json or yaml document fetched from
+// rawurl. The format is taken from the Content-Type header or the extension
+// of the path. If checksum is not empty the sha256 of the document must
+// match it. If cacheDir is not empty the last good copy of the document is
+// kept there and used when the server can't be reached, in which case cached
+// is true. Error responses like 404 are returned as errors because the
+// cached copy may be deleted or forbidden on the server. The cache is only a
+// fallback so failing to write it is a warning.
+func NewHTTPSource(client *http.Client, rawurl, checksum, cacheDir string) (s *Source, cached bool, err error) {
+	data, format, fetchErr := fetch(client, rawurl)
+	if fetchErr == nil {
+		if err := verifyChecksum(data, checksum); err != nil {
+			return nil, false, errors.Wrapf(err, "verifying %v failed", rawurl)
+		}
+
+		s, err := NewFileSource(bytes.NewReader(data), format)
+		if err != nil {
+			return nil, false, errors.Wrapf(err, "parsing %v failed", rawurl)
+		}
+
+		if cacheDir != "" {
+			if err := writeCache(cacheDir, rawurl, format, data); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: caching %v failed: %v\n", redact(rawurl), err)
+			}
+		}
+
+		return s, false, nil
+	}
+
+	if _, ok := fetchErr.(*statusError); ok || cacheDir == "" {
+		return nil, false, fetchErr
+	}
+
+	data, format, err = readCache(cacheDir, rawurl)
+	switch {
+	case err == errNotCached:
+		return nil, false, errors.Wrap(fetchErr, "no cached copy exists")
+	case err != nil:
+		return nil, false, errors.Wrapf(fetchErr, "cached copy can't be read (%v)", err)
+	}
+
+	if err := verifyChecksum(data, checksum); err != nil {
+		return nil, false, errors.Wrapf(err, "verifying cached copy of %v failed", rawurl)
+	}
+
+	s, err = NewFileSource(bytes.NewReader(data), format)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "parsing cached copy of %v failed", rawurl)
+	}
+
+	return s, true, nil
+}
+
+// fetch returns the document and its format.
+func fetch(client *http.Client, rawurl string) ([]byte, string, error) {
+	resp, err := client.Get(rawurl)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "fetching %v failed", rawurl)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", &statusError{rawurl, resp.Status}
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "reading %v failed", rawurl)
+	}
+
+	return data, httpFormat(resp.Header.Get("Content-Type"), resp.Request.URL), nil
+}
+
+// statusError is returned when the server responds with other status than
+// 200 OK.
+type statusError struct {
+	url    string
+	status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("fetching %v failed: %v", e.url, e.status)
+}
+
+// httpFormat returns the format of the document from the content type or
+// from the extension if the content type is not json or yaml.
+func httpFormat(contentType string, u *url.URL) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return "json"
+	case strings.HasSuffix(mediaType, "yaml"):
+		return "yaml"
+	}
+
+	ext := strings.TrimPrefix(path.Ext(u.Path), ".")
+	if ext == "yml" {
+		return "yaml"
+	}
+	return ext
+}
+
+// redact returns the URL with the password replaced by "xxxxx".
+func redact(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return rawurl
+	}
+	return u.Redacted()
+}
+
+func verifyChecksum(data []byte, checksum string) error {
+	if checksum == "" {
+		return nil
+	}
+
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, checksum) {
+		return fmt.Errorf("sha256 checksum mismatch: got %v; want %v", actual, checksum)
+	}
+
+	return nil
+}
+
+// cachePath returns the path of the cached copy of the document without the
+// extension that is the format.
+func cachePath(cacheDir, rawurl string) string {
+	sum := sha256.Sum256([]byte(rawurl))
+	return filepath.Join(cacheDir, hex.EncodeToString(sum[:]))
+}
+
+// writeCache replaces the cached copy of the document.
+func writeCache(cacheDir, rawurl, format string, data []byte) error {
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return errors.Wrapf(err, "creating cache directory %v failed", cacheDir)
+	}
+
+	f, err := ioutil.TempFile(cacheDir, ".tmp")
+	if err != nil {
+		return errors.Wrap(err, "creating cache file failed")
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "writing cache file failed")
+	}
+
+	// remove the copies in other formats
+	base := cachePath(cacheDir, rawurl)
+	old, _ := filepath.Glob(base + ".*")
+	for _, o := range old {
+		os.Remove(o)
+	}
+
+	return errors.Wrap(os.Rename(f.Name(), base+"."+format), "writing cache file failed")
+}
+
+// errNotCached is returned by readCache if the document is not cached.
+var errNotCached = errors.New("not cached")
+
+// readCache returns the cached copy of the document and its format.
+func readCache(cacheDir, rawurl string) ([]byte, string, error) {
+	matches, _ := filepath.Glob(cachePath(cacheDir, rawurl) + ".*")
+	if len(matches) == 0 {
+		return nil, "", errNotCached
+	}
+
+	data, err := ioutil.ReadFile(matches[0])
+	if err != nil {
+		return nil, "", errors.Wrap(err, "reading cache file failed")
+	}
+
+	return data, strings.TrimPrefix(filepath.Ext(matches[0]), "."), nil
+}
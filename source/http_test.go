@@ -0,0 +1,237 @@
+package source
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPSourcer(t *testing.T) {
+	jsonDoc := `{"key1":"val1","key2":"val2"}`
+	yamlDoc := "key1: val1\nkey2: val2\n"
+	parsed := map[string]interface{}{"key1": "val1", "key2": "val2"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/values", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, jsonDoc)
+	})
+	mux.HandleFunc("/values.yml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, yamlDoc)
+	})
+	mux.HandleFunc("/values.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-yaml")
+		fmt.Fprint(w, yamlDoc)
+	})
+	mux.HandleFunc("/values.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, yamlDoc)
+	})
+	mux.HandleFunc("/invalid.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "invalid")
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/values.yml", http.StatusFound)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	jsonSum := sha256.Sum256([]byte(jsonDoc))
+
+	testCases := []struct {
+		path     string
+		checksum string
+		ok       bool
+	}{
+		{"/values", "", true},
+		{"/values", hex.EncodeToString(jsonSum[:]), true},
+		{"/values.yml", "", true},
+		{"/values.yaml", "", true},
+		{"/redirect", "", true},
+		{"/values", "0000", false},
+		{"/values.txt", "", false},
+		{"/invalid.json", "", false},
+		{"/missing.json", "", false},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			s, cached, err := NewHTTPSource(srv.Client(), srv.URL+tc.path, tc.checksum, "")
+			if tc.ok != (err == nil) {
+				if err != nil {
+					t.Fatal(err)
+				} else {
+					t.Fatal("Get should have failed but haven't")
+				}
+			}
+
+			if !tc.ok {
+				return
+			}
+
+			if cached {
+				t.Error("Got cached copy")
+			}
+
+			if !reflect.DeepEqual(s.Get(), parsed) {
+				t.Errorf("Got %v; want %v", s.Get(), parsed)
+			}
+		})
+	}
+}
+
+func TestHTTPSourcerCache(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "casper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	doc := `{"key":"val1"}`
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprint(w, doc)
+	}))
+	defer srv.Close()
+
+	steps := []struct {
+		doc      string
+		status   int
+		checksum string
+		val      string
+		cached   bool
+		ok       bool
+	}{
+		{`{"key":"val1"}`, http.StatusOK, "", "val1", false, true},
+		// invalid documents are not cached
+		{`invalid`, http.StatusOK, "", "", false, false},
+		{`{"key":"val2"}`, http.StatusOK, "", "val2", false, true},
+		// error responses don't fall back to the cached copy
+		{"", http.StatusNotFound, "", "", false, false},
+		{"", http.StatusForbidden, "", "", false, false},
+		{"", http.StatusInternalServerError, "", "", false, false},
+		{"", http.StatusBadGateway, "", "", false, false},
+	}
+
+	for i, step := range steps {
+		doc, status = step.doc, step.status
+
+		s, cached, err := NewHTTPSource(srv.Client(), srv.URL+"/values", step.checksum, cacheDir)
+		if step.ok != (err == nil) {
+			t.Fatalf("Step%v: got error %v", i, err)
+		}
+
+		if !step.ok {
+			if status != http.StatusOK && (err == nil || !strings.Contains(err.Error(), http.StatusText(status))) {
+				t.Errorf("Step%v: got %v; want %v error", i, err, status)
+			}
+			continue
+		}
+
+		if cached != step.cached {
+			t.Errorf("Step%v: got cached %v; want %v", i, cached, step.cached)
+		}
+
+		if val := s.Get()["key"]; val != step.val {
+			t.Errorf("Step%v: got %v; want %v", i, val, step.val)
+		}
+	}
+
+	// the server is down
+	client := srv.Client()
+	srv.Close()
+	s, cached, err := NewHTTPSource(client, srv.URL+"/values", "", cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cached || s.Get()["key"] != "val2" {
+		t.Errorf("Got %v, %v; want cached val2", cached, s.Get())
+	}
+
+	// the cached copy is verified too
+	if _, _, err := NewHTTPSource(client, srv.URL+"/values", "0000", cacheDir); err == nil {
+		t.Error("Got no error for checksum mismatch of the cached copy")
+	}
+
+	// not cached yet
+	_, _, err = NewHTTPSource(client, srv.URL+"/other", "", cacheDir)
+	if err == nil || !strings.HasPrefix(err.Error(), "no cached copy exists: fetching "+srv.URL+"/other failed") {
+		t.Errorf("Got %v; want no cached copy error", err)
+	}
+}
+
+func TestHTTPSourcerCacheWriteFailure(t *testing.T) {
+	f, err := ioutil.TempFile("", "casper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"key":"val"}`)
+	}))
+	defer srv.Close()
+
+	// the cache directory can't be created over the file
+	s, cached, err := NewHTTPSource(srv.Client(), srv.URL+"/values", "", filepath.Join(f.Name(), "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cached || s.Get()["key"] != "val" {
+		t.Errorf("Got %v, %v; want fetched val", cached, s.Get())
+	}
+}
+
+func TestHTTPSourcerCacheTimeout(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "casper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	var slow int32
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&slow) == 1 {
+			<-done
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"key":"val"}`)
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	client := srv.Client()
+	client.Timeout = 100 * time.Millisecond
+
+	if _, _, err := NewHTTPSource(client, srv.URL+"/values", "", cacheDir); err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt32(&slow, 1)
+	s, cached, err := NewHTTPSource(client, srv.URL+"/values", "", cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cached || s.Get()["key"] != "val" {
+		t.Errorf("Got %v, %v; want cached val", cached, s.Get())
+	}
+}
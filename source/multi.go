@@ -2,30 +2,243 @@ package source
 
 import (
 	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 )
 
-// NewMultiSourcer create source that is a collection of value sources.
+// MergeMode defines how the values of a source are merged with the values of
+// the sources before it. Nested maps are always merged.
+type MergeMode int
+
+// Merge modes.
+const (
+	// Override replaces the previous values.
+	Override MergeMode = iota
+	// Append collects the previous and the new values in a list.
+	Append
+	// ErrorOnConflict fails if a key already has a different value.
+	ErrorOnConflict
+)
+
+// ParseMergeMode returns the merge mode with the given name.
+func ParseMergeMode(name string) (MergeMode, error) {
+	switch name {
+	case "override":
+		return Override, nil
+	case "append":
+		return Append, nil
+	case "error":
+		return ErrorOnConflict, nil
+	}
+	return 0, fmt.Errorf("invalid merge mode '%v'", name)
+}
+
+type mergeSource struct {
+	Getter
+	mode MergeMode
+}
+
+// WithMergeMode returns the source with the merge mode used by
+// NewMultiSourcer. Sources without merge mode override the previous values.
+func WithMergeMode(s Getter, mode MergeMode) Getter {
+	return mergeSource{s, mode}
+}
+
+// NewMultiSourcer create source that is a collection of value sources. The
+// sources are merged in order so the later sources take precedence. The
+// provenance of the merged values is recorded.
 func NewMultiSourcer(vss ...Getter) (*Source, error) {
 	vars := map[string]interface{}{}
+	prov := map[string]*Provenance{}
 
 	for _, s := range vss {
-		for k, v := range s.Get() {
-			if prev, ok := vars[k]; ok {
-				switch p := prev.(type) {
-				case interface{}:
-					vars[k] = []interface{}{p, v}
-				case []interface{}:
-					vars[k] = append(p, v)
-				default:
-					return nil, fmt.Errorf("multy sources merging failed")
+		m := &merger{mode: Override, prov: prov}
+		for unwrapped := false; !unwrapped; {
+			switch w := s.(type) {
+			case mergeSource:
+				m.mode, s = w.mode, w.Getter
+			case originSource:
+				m.origin, s = w.origin, w.Getter
+			default:
+				unwrapped = true
+			}
+		}
+		m.src, _ = s.(*Source)
+
+		if err := m.merge(vars, s.Get(), nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Source{body: vars, prov: prov}, nil
+}
+
+// merger merges the values of one source and records their provenance.
+type merger struct {
+	mode   MergeMode
+	origin string
+	src    *Source
+	prov   map[string]*Provenance
+}
+
+// merge merges src in dst. The maps of the sources are copied before they
+// are changed.
+func (m *merger) merge(dst, src map[string]interface{}, path []string) error {
+	for k, v := range src {
+		p := append(path[:len(path):len(path)], k)
+		key := strings.Join(p, ".")
+
+		prev, ok := dst[k]
+		if !ok {
+			dst[k] = v
+			m.record(p, v, nil, nil)
+			continue
+		}
+
+		prevMap, prevOk := toStringMap(prev)
+		nextMap, nextOk := toStringMap(v)
+		if prevOk && nextOk {
+			if err := m.merge(prevMap, nextMap, p); err != nil {
+				return err
+			}
+			dst[k] = prevMap
+			continue
+		}
+
+		origins, shadowed, secret := m.forget(key)
+		switch m.mode {
+		case Override:
+			dst[k] = v
+			m.record(p, v, nil, append(shadowed, origins...))
+		case Append:
+			dst[k] = append(toList(prev), toList(v)...)
+			m.record(p, dst[k], origins, shadowed)
+			m.prov[key].Secret = m.prov[key].Secret || secret
+		case ErrorOnConflict:
+			if !reflect.DeepEqual(prev, v) {
+				if secret || m.isSecret(key) {
+					return fmt.Errorf("key %v has conflicting values", key)
 				}
+				return fmt.Errorf("key %v has conflicting values %v and %v", key, prev, v)
+			}
+			m.record(p, v, origins, shadowed)
+			m.prov[key].Secret = m.prov[key].Secret || secret
+		}
+	}
 
-				continue
+	return nil
+}
 
+// record sets the provenance of the leaf values in v. The origins are
+// appended to the given ones.
+func (m *merger) record(path []string, v interface{}, origins, shadowed []Origin) {
+	if vm, ok := toStringMap(v); ok {
+		for k, vi := range vm {
+			m.record(append(path[:len(path):len(path)], k), vi, origins, shadowed)
+		}
+		return
+	}
+
+	key := strings.Join(path, ".")
+	p := &Provenance{
+		Path:     path,
+		Value:    v,
+		Origins:  append([]Origin{}, origins...),
+		Shadowed: append([]Origin{}, shadowed...),
+	}
+
+	// the values of merged sources keep their provenance
+	if inner := m.innerProvenance(key); inner != nil {
+		p.Origins = append(p.Origins, inner.Origins...)
+		p.Shadowed = append(p.Shadowed, inner.Shadowed...)
+	} else {
+		o := Origin{Source: m.origin}
+		if m.src != nil {
+			o.Line = m.src.line(path)
+		}
+		p.Origins = append(p.Origins, o)
+	}
+	p.Secret = m.isSecret(key)
+
+	m.prov[key] = p
+}
+
+// isSecret reports whether the value with the key is decrypted by the
+// source.
+func (m *merger) isSecret(key string) bool {
+	if inner := m.innerProvenance(key); inner != nil {
+		return inner.Secret
+	}
+	return m.src != nil && m.src.secrets[key]
+}
+
+// innerProvenance returns the provenance of the value with the key if the
+// source is created by NewMultiSourcer. The origins without name get the
+// name of the source.
+func (m *merger) innerProvenance(key string) *Provenance {
+	if m.src == nil || m.src.prov[key] == nil {
+		return nil
+	}
+
+	inner := *m.src.prov[key]
+	for _, origins := range []*[]Origin{&inner.Origins, &inner.Shadowed} {
+		named := make([]Origin, len(*origins))
+		for i, o := range *origins {
+			if o.Source == "" {
+				o.Source = m.origin
 			}
-			vars[k] = v
+			named[i] = o
 		}
+		*origins = named
 	}
 
-	return &Source{vars}, nil
+	return &inner
+}
+
+// forget removes the provenance of the value with the key and the values
+// nested in it and returns their origins and if any of them is secret.
+func (m *merger) forget(key string) (origins, shadowed []Origin, secret bool) {
+	keys := []string{}
+	for k := range m.prov {
+		if k == key || strings.HasPrefix(k, key+".") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		origins = append(origins, m.prov[k].Origins...)
+		shadowed = append(shadowed, m.prov[k].Shadowed...)
+		secret = secret || m.prov[k].Secret
+		delete(m.prov, k)
+	}
+	return origins, shadowed, secret
+}
+
+// toStringMap returns a copy of the map if v is a map. The yaml maps are
+// converted to maps with string keys.
+func toStringMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			c[k] = v
+		}
+		return c, true
+	case map[interface{}]interface{}:
+		c := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			c[fmt.Sprint(k)] = v
+		}
+		return c, true
+	}
+	return nil, false
+}
+
+func toList(v interface{}) []interface{} {
+	if l, ok := v.([]interface{}); ok {
+		return append([]interface{}{}, l...)
+	}
+	return []interface{}{v}
 }
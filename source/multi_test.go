@@ -57,14 +57,82 @@ func TestMultiSourcer(t *testing.T) {
 				}),
 			},
 			map[string]interface{}{
-				"key1": []interface{}{
-					"var1",
-					"var3",
-				},
+				"key1": "var3",
 				"key2": "var2",
 			},
 			true,
 		},
+		{
+			[]Getter{
+				NewSource(map[string]interface{}{
+					"key1": map[string]interface{}{"key2": "var2", "key3": "var3"},
+				}),
+				NewSource(map[string]interface{}{
+					"key1": map[interface{}]interface{}{"key3": "var3a", "key4": "var4"},
+				}),
+			},
+			map[string]interface{}{
+				"key1": map[string]interface{}{"key2": "var2", "key3": "var3a", "key4": "var4"},
+			},
+			true,
+		},
+		{
+			[]Getter{
+				NewSource(map[string]interface{}{
+					"key1": "var1",
+					"key2": []interface{}{"var2"},
+				}),
+				WithMergeMode(NewSource(map[string]interface{}{
+					"key1": "var1a",
+					"key2": []interface{}{"var2a"},
+				}), Append),
+			},
+			map[string]interface{}{
+				"key1": []interface{}{"var1", "var1a"},
+				"key2": []interface{}{"var2", "var2a"},
+			},
+			true,
+		},
+		{
+			[]Getter{
+				NewSource(map[string]interface{}{
+					"key1": map[string]interface{}{"key2": "var2"},
+				}),
+				WithMergeMode(NewSource(map[string]interface{}{
+					"key1": map[string]interface{}{"key2": "var2", "key3": "var3"},
+				}), ErrorOnConflict),
+			},
+			map[string]interface{}{
+				"key1": map[string]interface{}{"key2": "var2", "key3": "var3"},
+			},
+			true,
+		},
+		{
+			[]Getter{
+				NewSource(map[string]interface{}{
+					"key1": map[string]interface{}{"key2": "var2"},
+				}),
+				WithMergeMode(NewSource(map[string]interface{}{
+					"key1": map[string]interface{}{"key2": "var2a"},
+				}), ErrorOnConflict),
+			},
+			nil,
+			false,
+		},
+		{
+			[]Getter{
+				NewSource(map[string]interface{}{
+					"key1": map[string]interface{}{"key2": "var2"},
+				}),
+				NewSource(map[string]interface{}{
+					"key1": "var1",
+				}),
+			},
+			map[string]interface{}{
+				"key1": "var1",
+			},
+			true,
+		},
 	}
 
 	for i, tc := range testCases {
@@ -84,3 +152,43 @@ func TestMultiSourcer(t *testing.T) {
 		})
 	}
 }
+
+func TestMultiSourcerDoesNotChangeSources(t *testing.T) {
+	first := map[string]interface{}{"key1": map[string]interface{}{"key2": "var2"}}
+	second := map[string]interface{}{"key1": map[string]interface{}{"key3": "var3"}}
+
+	if _, err := NewMultiSourcer(NewSource(first), NewSource(second)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{"key1": map[string]interface{}{"key2": "var2"}}
+	if !reflect.DeepEqual(first, want) {
+		t.Errorf("Got %v; want %v", first, want)
+	}
+}
+
+func TestParseMergeMode(t *testing.T) {
+	testCases := []struct {
+		name string
+		mode MergeMode
+		ok   bool
+	}{
+		{"override", Override, true},
+		{"append", Append, true},
+		{"error", ErrorOnConflict, true},
+		{"invalid", 0, false},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			mode, err := ParseMergeMode(tc.name)
+			if tc.ok != (err == nil) {
+				t.Fatalf("Got error %v", err)
+			}
+
+			if mode != tc.mode {
+				t.Errorf("Got %v; want %v", mode, tc.mode)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package source
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Origin is the place where a value is defined.
+type Origin struct {
+	Source string
+	Line   int // 0 if the line is not known
+}
+
+func (o Origin) String() string {
+	if o.Line == 0 {
+		return o.Source
+	}
+	return fmt.Sprintf("%v:%v", o.Source, o.Line)
+}
+
+// Provenance describes where a merged leaf value comes from.
+type Provenance struct {
+	Path  []string
+	Value interface{}
+	// Origins are the sources that set the value. There are more than one
+	// only if the values are appended or equal.
+	Origins []Origin
+	// Shadowed are the sources with values overridden by the origins.
+	Shadowed []Origin
+	// Secret is set if the value is decrypted. It must not be shown.
+	Secret bool
+}
+
+// Redacted is shown instead of the secret values.
+const Redacted = "<redacted>"
+
+// String returns the value or Redacted if the value is secret.
+func (p *Provenance) String() string {
+	if p.Secret {
+		return Redacted
+	}
+	return fmt.Sprint(p.Value)
+}
+
+type originSource struct {
+	Getter
+	origin string
+}
+
+// WithOrigin returns the source with the name used for the provenance of its
+// values in NewMultiSourcer.
+func WithOrigin(s Getter, origin string) Getter {
+	return originSource{s, origin}
+}
+
+// Provenance returns the provenance of the leaf values by their keys joined
+// with dots. It is set only for the sources created by NewMultiSourcer.
+func (s *Source) Provenance() map[string]*Provenance {
+	return s.prov
+}
+
+// line returns the line of the value with the path in the data of the source
+// or 0 if it is not known. The keys are searched in order, so nested keys are
+// found after their parents in all supported formats.
+func (s *Source) line(path []string) int {
+	if s.data == nil {
+		return 0
+	}
+
+	lines := strings.Split(string(s.data), "\n")
+	n := 0
+	for _, key := range path {
+		for ; n < len(lines) && !isKeyLine(lines[n], key); n++ {
+		}
+
+		if n == len(lines) {
+			return 0
+		}
+	}
+
+	return n + 1
+}
+
+// isKeyLine reports whether the key is defined on the line, e.g. `key:`,
+// `"key": `, `key = `, `[key]`, `[parent.key]`, `key {` or `key "label" {`.
+func isKeyLine(line, key string) bool {
+	for i := strings.Index(line, key); i >= 0; {
+		before := i == 0 || strings.ContainsRune(" \t\"'[.{,", rune(line[i-1]))
+		after := strings.TrimLeft(strings.TrimLeft(line[i+len(key):], `"'`), " \t")
+		if before && after != "" && strings.ContainsRune(":=].{\"", rune(after[0])) {
+			return true
+		}
+
+		next := strings.Index(line[i+1:], key)
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return false
+}
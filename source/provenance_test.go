@@ -0,0 +1,115 @@
+package source
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProvenance(t *testing.T) {
+	fileSource := func(doc string) *Source {
+		s, err := NewFileSource(strings.NewReader(doc), "yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	base := WithOrigin(fileSource("key1: val1\nkey2:\n  key3: val3\n  key4: val4\n"), "base.yaml")
+	env := WithOrigin(fileSource("key2:\n  key4: val4a\n"), "env.yaml")
+	list := WithOrigin(NewSource(map[string]interface{}{"key1": "val1a"}), "list")
+
+	inner, err := NewMultiSourcer(base, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		s    []Getter
+		prov map[string]*Provenance
+	}{
+		{
+			[]Getter{base, env},
+			map[string]*Provenance{
+				"key1":      {[]string{"key1"}, "val1", []Origin{{"base.yaml", 1}}, []Origin{}, false},
+				"key2.key3": {[]string{"key2", "key3"}, "val3", []Origin{{"base.yaml", 3}}, []Origin{}, false},
+				"key2.key4": {[]string{"key2", "key4"}, "val4a", []Origin{{"env.yaml", 2}}, []Origin{{"base.yaml", 4}}, false},
+			},
+		},
+		{
+			[]Getter{base, WithMergeMode(list, Append)},
+			map[string]*Provenance{
+				"key1":      {[]string{"key1"}, []interface{}{"val1", "val1a"}, []Origin{{"base.yaml", 1}, {"list", 0}}, []Origin{}, false},
+				"key2.key3": {[]string{"key2", "key3"}, "val3", []Origin{{"base.yaml", 3}}, []Origin{}, false},
+				"key2.key4": {[]string{"key2", "key4"}, "val4", []Origin{{"base.yaml", 4}}, []Origin{}, false},
+			},
+		},
+		{
+			[]Getter{list, WithOrigin(inner, "inner")},
+			map[string]*Provenance{
+				"key1":      {[]string{"key1"}, "val1", []Origin{{"base.yaml", 1}}, []Origin{{"list", 0}}, false},
+				"key2.key3": {[]string{"key2", "key3"}, "val3", []Origin{{"base.yaml", 3}}, []Origin{}, false},
+				"key2.key4": {[]string{"key2", "key4"}, "val4a", []Origin{{"env.yaml", 2}}, []Origin{{"base.yaml", 4}}, false},
+			},
+		},
+		{
+			[]Getter{base, WithOrigin(NewSource(map[string]interface{}{"key2": "val2"}), "flat")},
+			map[string]*Provenance{
+				"key1": {[]string{"key1"}, "val1", []Origin{{"base.yaml", 1}}, []Origin{}, false},
+				"key2": {[]string{"key2"}, "val2", []Origin{{"flat", 0}}, []Origin{{"base.yaml", 3}, {"base.yaml", 4}}, false},
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			s, err := NewMultiSourcer(tc.s...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(s.Provenance(), tc.prov) {
+				for k, p := range s.Provenance() {
+					t.Logf("%v: %+v", k, *p)
+				}
+				t.Errorf("Got %v; want %v", s.Provenance(), tc.prov)
+			}
+		})
+	}
+}
+
+func TestSourceLine(t *testing.T) {
+	testCases := []struct {
+		doc    string
+		format string
+		path   []string
+		line   int
+	}{
+		{"key1: val1\nkey2:\n  key1: val2\n", "yaml", []string{"key2", "key1"}, 3},
+		{"key1: val1\nkey2:\n  key1: val2\n", "yaml", []string{"key1"}, 1},
+		{"{\n  \"key1\": \"val1\",\n  \"key2\": {\"key3\": \"val3\"}\n}\n", "json", []string{"key2", "key3"}, 3},
+		{"key1 = \"val1\"\n\n[key2]\nkey3 = \"val3\"\n", "toml", []string{"key2", "key3"}, 4},
+		{"[key2.key3]\nkey4 = val4\n", "ini", []string{"key2", "key3", "key4"}, 2},
+		{"key1 = \"val1\"\nkey2 \"key3\" {\n  key4 = \"val4\"\n}\n", "hcl", []string{"key2", "key3", "key4"}, 3},
+		{"KEY1=val1\nKEY2=val2\n", "env", []string{"KEY2"}, 2},
+		{"key10: val10\nkey1: val1\n", "yaml", []string{"key1"}, 2},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			s, err := NewFileSource(strings.NewReader(tc.doc), tc.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line := s.line(tc.path); line != tc.line {
+				t.Errorf("Got %v; want %v", line, tc.line)
+			}
+		})
+	}
+
+	if line := NewSource(map[string]interface{}{"key": "val"}).line([]string{"key"}); line != 0 {
+		t.Errorf("Got %v; want 0", line)
+	}
+}
@@ -0,0 +1,89 @@
+package source
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/getsops/sops/v3/decrypt"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// sopsPrefix starts the values encrypted by SOPS.
+const sopsPrefix = "ENC[AES256_GCM,"
+
+// IsSOPS reports whether the json or yaml document is encrypted with SOPS.
+func IsSOPS(data []byte) bool {
+	doc := struct {
+		SOPS *struct {
+			MAC string `yaml:"mac"`
+		} `yaml:"sops"`
+	}{}
+	return yaml.Unmarshal(data, &doc) == nil && doc.SOPS != nil && doc.SOPS.MAC != ""
+}
+
+// NewSOPSSource creates new source from a json or yaml document encrypted
+// with SOPS. The document is decrypted in memory by sops, so the keys are
+// found the same as by the sops command, e.g. the age keys are read from
+// SOPS_AGE_KEY_FILE. The encrypted values are marked as secret in the
+// provenance.
+func NewSOPSSource(r io.Reader, format string) (*Source, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading sops source failed")
+	}
+
+	if format == "yml" {
+		format = "yaml"
+	}
+
+	plain, err := decrypt.Data(data, format)
+	if err != nil {
+		return nil, errors.Wrap(err, "decrypting sops document failed")
+	}
+
+	s, err := NewFileSource(bytes.NewReader(plain), format)
+	if err != nil {
+		return nil, err
+	}
+
+	// json is parsed as yaml too, the metadata is not a value
+	doc := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrap(err, "parsing sops document failed")
+	}
+	delete(doc, "sops")
+
+	s.secrets = map[string]bool{}
+	sopsSecrets(doc, nil, s.secrets)
+
+	// the provenance points to the lines of the encrypted document
+	s.data = data
+	return s, nil
+}
+
+// sopsSecrets adds the keys of the encrypted values in v to secrets. The
+// items in lists have the key of the list.
+func sopsSecrets(v interface{}, path []string, secrets map[string]bool) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, vi := range val {
+			sopsSecrets(vi, append(path[:len(path):len(path)], k), secrets)
+		}
+	case map[interface{}]interface{}:
+		for k, vi := range val {
+			sopsSecrets(vi, append(path[:len(path):len(path)], fmt.Sprint(k)), secrets)
+		}
+	case []interface{}:
+		for _, vi := range val {
+			sopsSecrets(vi, path, secrets)
+		}
+	case string:
+		if strings.HasPrefix(val, sopsPrefix) {
+			secrets[strings.Join(path, ".")] = true
+		}
+	}
+}
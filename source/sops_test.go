@@ -0,0 +1,196 @@
+package source
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestSOPSSourcer(t *testing.T) {
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	yamlDoc, err := ioutil.ReadFile("testdata/secrets.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jsonDoc, err := ioutil.ReadFile("testdata/secrets.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	macOnlyDoc, err := ioutil.ReadFile("testdata/secrets-mac-only.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyFile := map[string]string{"SOPS_AGE_KEY_FILE": "testdata/age.key"}
+
+	testCases := []struct {
+		doc     []byte
+		format  string
+		env     map[string]string
+		parsed  map[string]interface{}
+		secrets map[string]bool
+		err     string
+	}{
+		{
+			yamlDoc, "yaml", keyFile,
+			map[string]interface{}{
+				"db": map[interface{}]interface{}{
+					"user":     "admin",
+					"password": "s3cr3t",
+					"port":     5432,
+					"ssl":      true,
+					"ratio":    0.5,
+				},
+				"hosts":              []interface{}{"a.example.com", "b.example.com"},
+				"empty":              "",
+				"region_unencrypted": "eu-west-1",
+			},
+			map[string]bool{"db.user": true, "db.password": true, "db.port": true, "db.ssl": true, "db.ratio": true, "hosts": true},
+			"",
+		},
+		{
+			jsonDoc, "json", keyFile,
+			map[string]interface{}{
+				"db":    map[string]interface{}{"password": "s3cr3t", "port": 5432.0},
+				"token": "abc",
+			},
+			map[string]bool{"db.password": true, "db.port": true, "token": true},
+			"",
+		},
+		{
+			macOnlyDoc, "yml", keyFile,
+			map[string]interface{}{
+				"db":     map[interface{}]interface{}{"user": "admin", "password": "s3cr3t"},
+				"region": "eu-west-1",
+			},
+			map[string]bool{"db.password": true},
+			"",
+		},
+		{
+			// only the encrypted values are in the mac
+			bytes.Replace(macOnlyDoc, []byte("eu-west-1"), []byte("us-east-1"), 1), "yaml", keyFile,
+			map[string]interface{}{
+				"db":     map[interface{}]interface{}{"user": "admin", "password": "s3cr3t"},
+				"region": "us-east-1",
+			},
+			map[string]bool{"db.password": true},
+			"",
+		},
+		{yamlDoc, "yaml", map[string]string{"SOPS_AGE_KEY": other.String()}, nil, nil, "decrypting sops document failed"},
+		{yamlDoc, "yaml", map[string]string{"SOPS_AGE_KEY_FILE": "testdata/missing.key"}, nil, nil, "decrypting sops document failed"},
+		{bytes.Replace(yamlDoc, []byte("eu-west-1"), []byte("us-east-1"), 1), "yaml", keyFile, nil, nil, "decrypting sops document failed: Failed to verify data integrity"},
+		{bytes.Replace(yamlDoc, []byte("    password:"), []byte("    pass:"), 1), "yaml", keyFile, nil, nil, "decrypting sops document failed"},
+		{[]byte("key: val\n"), "yaml", keyFile, nil, nil, "decrypting sops document failed"},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			for k, v := range tc.env {
+				os.Setenv(k, v)
+				defer os.Unsetenv(k)
+			}
+
+			s, err := NewSOPSSource(bytes.NewReader(tc.doc), tc.format)
+			if (tc.err == "") != (err == nil) {
+				if err != nil {
+					t.Fatal(err)
+				} else {
+					t.Fatal("Get should have failed but haven't")
+				}
+			}
+
+			if err != nil {
+				if !strings.HasPrefix(err.Error(), tc.err) {
+					t.Errorf("Got %v; want %v", err, tc.err)
+				}
+				return
+			}
+
+			if !reflect.DeepEqual(s.Get(), tc.parsed) {
+				t.Errorf("Got %v; want %v", s.Get(), tc.parsed)
+			}
+
+			if !reflect.DeepEqual(s.secrets, tc.secrets) {
+				t.Errorf("Got %v; want %v", s.secrets, tc.secrets)
+			}
+		})
+	}
+}
+
+func TestIsSOPS(t *testing.T) {
+	testCases := []struct {
+		path string
+		sops bool
+	}{
+		{"testdata/secrets.yaml", true},
+		{"testdata/secrets.json", true},
+		{"testdata/secrets-mac-only.yaml", true},
+		{"testdata/age.key", false},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			data, err := ioutil.ReadFile(tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if sops := IsSOPS(data); sops != tc.sops {
+				t.Errorf("Got %v; want %v", sops, tc.sops)
+			}
+		})
+	}
+}
+
+func TestSOPSProvenance(t *testing.T) {
+	f, err := os.Open("testdata/secrets.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	os.Setenv("SOPS_AGE_KEY_FILE", "testdata/age.key")
+	defer os.Unsetenv("SOPS_AGE_KEY_FILE")
+
+	secrets, err := NewSOPSSource(f, "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := NewSource(map[string]interface{}{"db": map[string]interface{}{"password": "plain", "user": "admin"}})
+
+	_, err = NewMultiSourcer(secrets, WithMergeMode(plain, ErrorOnConflict))
+	if want := "key db.password has conflicting values"; err == nil || err.Error() != want {
+		t.Errorf("Got %v; want %v", err, want)
+	}
+
+	s, err := NewMultiSourcer(WithOrigin(plain, "plain"), WithOrigin(secrets, "secrets.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := s.Provenance()["db.password"]
+	if !p.Secret || p.String() != Redacted {
+		t.Errorf("Got %v; want %v", p, Redacted)
+	}
+
+	if want := (Origin{"secrets.yaml", 3}); !reflect.DeepEqual(p.Origins, []Origin{want}) {
+		t.Errorf("Got %v; want %v", p.Origins, want)
+	}
+
+	if p := s.Provenance()["region_unencrypted"]; p.Secret || p.String() != "eu-west-1" {
+		t.Errorf("Got %v; want eu-west-1", p)
+	}
+}
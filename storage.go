@@ -1,5 +1,7 @@
 package casper
 
+import "github.com/miracl/casper/diff"
+
 // Storage is interface for storages.
 type Storage interface {
 	String(format string) (string, error)
@@ -12,3 +14,9 @@ type Storage interface {
 type Changes interface {
 	Len() int
 }
+
+// KeyChanges is implemented by the changes that can be listed per key of the
+// config. The keys are flattened like for Consul storage, e.g. db/host.
+type KeyChanges interface {
+	KeyChanges() diff.KVChanges
+}
@@ -1,17 +1,14 @@
 package consul
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/url"
-	"strings"
 
 	"github.com/hashicorp/consul/api"
 	"github.com/miracl/casper"
 	"github.com/miracl/casper/consul"
 	"github.com/miracl/casper/diff"
 	"github.com/pkg/errors"
-	yaml "gopkg.in/yaml.v2"
 )
 
 // DefaultIgnoreVal is the default value that need to be set for a key to be
@@ -30,34 +27,31 @@ type kv interface {
 type Storage struct {
 	kv        kv
 	ignoreVal string
+	lists     consul.ListMode
 }
 
 // New returns new consul storage.
 func New(addr string) (*Storage, error) {
-	cfg := &api.Config{}
-
-	ignore := ""
-	if addr != "" {
-		addr, err := url.Parse(addr)
-		if err != nil {
-			return nil, errors.Wrapf(err, "parsing Consul address %v failed", addr)
-		}
-		cfg.Address = addr.Host
-		cfg.Scheme = addr.Scheme
-		cfg.Token = addr.Query().Get("token")
-
-		ignore = addr.Query().Get("ignore")
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing Consul address %v failed", addr)
 	}
 
-	client, err := api.NewClient(cfg)
+	client, err := consul.NewClient(u)
 	if err != nil {
-		return nil, errors.Wrap(err, "creating Consul client failed")
+		return nil, err
 	}
 
+	ignore := u.Query().Get("ignore")
 	if ignore == "" {
 		ignore = DefaultIgnoreVal
 	}
-	return &Storage{client.KV(), ignore}, nil
+	lists, err := consul.ParseListMode(u.Query().Get("lists"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing Consul address %v failed", addr)
+	}
+
+	return &Storage{client.KV(), ignore, lists}, nil
 }
 
 func (s Storage) String(format string) (string, error) {
@@ -65,7 +59,7 @@ func (s Storage) String(format string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return kvPairsToString(pairs, format), nil
+	return consul.KVPairsToString(pairs, format, s.lists), nil
 }
 
 // GetChanges returns changes between the config and the Storage content.
@@ -75,7 +69,12 @@ func (s Storage) GetChanges(config []byte, format, key string) (casper.Changes,
 		return nil, errors.Wrap(err, "getting key/value pairs from Consul failed")
 	}
 
-	return getChanges(pairs, config, format, key, s.ignoreVal)
+	return consul.KVChanges(pairs, config, format, key, s.ignoreVal, s.lists)
+}
+
+// Lists returns how the storage flattens the lists of the config.
+func (s Storage) Lists() consul.ListMode {
+	return s.lists
 }
 
 // Diff returns the visual representation of the changes.
@@ -108,73 +107,3 @@ func (s Storage) push(change interface{}) error {
 
 	return fmt.Errorf("invalid change type: %T", change)
 }
-
-func kvPairsToString(pairs api.KVPairs, format string) string {
-	j := consul.KVPairsToMap(pairs)
-
-	var res []byte
-	switch format {
-	case "json":
-		res, _ = json.MarshalIndent(j, "", "  ")
-	case "jsonraw":
-		res, _ = json.Marshal(j)
-	default:
-		res, _ = yaml.Marshal(j)
-
-	}
-
-	return string(res)
-}
-
-func getChanges(pairs api.KVPairs, config []byte, format, key, ignoreVal string) (diff.KVChanges, error) {
-	consulChanges, err := consul.GetChanges(pairs, config, format)
-	if err != nil {
-		return nil, err
-	}
-
-	ignoredPaths := []string{}
-
-	kvChanges := diff.KVChanges{}
-	for _, c := range consulChanges {
-		// skip ignored pairs
-		if ignoreVal != "" && c.NewVal == ignoreVal {
-			ignoredPaths = append(ignoredPaths, c.Key)
-			continue
-		}
-
-		if key != "" && key != c.Key {
-			continue
-		}
-
-		switch c.Action {
-		case consul.ConsulAdd:
-			kvChanges = append(kvChanges, diff.NewAdd(c.Key, c.NewVal))
-		case consul.ConsulRemove:
-			kvChanges = append(kvChanges, diff.NewRemove(c.Key, c.Val))
-		case consul.ConsulUpdate:
-			kvChanges = append(kvChanges, diff.NewUpdate(c.Key, c.Val, c.NewVal))
-		}
-
-	}
-
-	// check for ignored folders
-	notIgnoreChanges := diff.KVChanges{}
-	for _, c := range kvChanges {
-		if isPathIgnored(c.Key(), ignoredPaths) {
-			continue
-		}
-		notIgnoreChanges = append(notIgnoreChanges, c)
-	}
-
-	return notIgnoreChanges, nil
-}
-
-func isPathIgnored(path string, ignoredPaths []string) bool {
-	for _, p := range ignoredPaths {
-		if strings.HasPrefix(path, p) {
-			return true
-		}
-	}
-
-	return false
-}
@@ -10,7 +10,7 @@ import (
 	"testing"
 
 	"github.com/hashicorp/consul/api"
-	"github.com/miracl/casper/diff"
+	"github.com/miracl/casper/consul"
 )
 
 // It is defined in each package so you can run `go test ./...`
@@ -91,7 +91,7 @@ func TestConsulStorageString(t *testing.T) {
 
 	for i, tc := range testCases {
 		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
-			s := &Storage{&kvMock{list: tc.list, listErr: tc.listErr}, ""}
+			s := &Storage{&kvMock{list: tc.list, listErr: tc.listErr}, "", consul.IndexedLists}
 			str, err := s.String("jsonraw")
 			if err != tc.err {
 				t.Fatalf("Got %v; want %v", err, tc.err)
@@ -151,7 +151,7 @@ func TestConsulStoragePush(t *testing.T) {
 
 	for i, tc := range testCases {
 		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
-			s := &Storage{&kvMock{list: tc.list}, "_ignore"}
+			s := &Storage{&kvMock{list: tc.list}, "_ignore", consul.IndexedLists}
 
 			cs, err := s.GetChanges([]byte(tc.config), "json", "")
 			if err != nil {
@@ -196,178 +196,3 @@ func TestConsulStoragePush(t *testing.T) {
 		})
 	}
 }
-
-func TestKVPairsToString(t *testing.T) {
-	testCases := []struct {
-		pairs  api.KVPairs
-		format string
-		out    string
-	}{
-		{nil, "jsonraw", "{}"},
-		{
-			api.KVPairs{
-				&api.KVPair{Key: "key1", Value: []byte("val1")},
-			},
-			"jsonraw", `{"key1":"val1"}`,
-		},
-		{
-			api.KVPairs{
-				&api.KVPair{Key: "key1", Value: []byte("val1")},
-			},
-			"json",
-			"" +
-				"{\n" +
-				`  "key1": "val1"` + "\n" +
-				"}",
-		},
-		{
-			api.KVPairs{
-				&api.KVPair{Key: "key1", Value: []byte("val1")},
-			},
-			"yaml",
-			"key1: val1\n",
-		},
-		{
-			api.KVPairs{
-				&api.KVPair{Key: "key1", Value: []byte("val1")},
-			},
-			"invalid",
-			"key1: val1\n",
-		},
-	}
-
-	for i, tc := range testCases {
-		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
-			out := kvPairsToString(tc.pairs, tc.format)
-			if out != tc.out {
-				t.Errorf("Got `%v`; want `%v`", out, tc.out)
-			}
-		})
-	}
-}
-
-func TestGetChanges(t *testing.T) {
-	testCases := []struct {
-		pairs  api.KVPairs
-		config string
-		format string
-		key    string
-		ch     diff.KVChanges
-		ok     bool
-	}{
-		{nil, "", "", "", nil, false},
-		{
-			api.KVPairs{
-				&api.KVPair{Key: "key1", Value: []byte("val1")},
-			},
-			`{"key1": "val1"}`, "json", "",
-			diff.KVChanges{},
-			true,
-		},
-		{
-			api.KVPairs{
-				&api.KVPair{Key: "key1", Value: []byte("val1")},
-			},
-			`{"key1": "val1", "key2": "val2"}`, "json", "",
-			diff.KVChanges{
-				diff.NewAdd("key2", "val2"),
-			},
-			true,
-		},
-		{
-			api.KVPairs{
-				&api.KVPair{Key: "key1", Value: []byte("val1")},
-				&api.KVPair{Key: "key2", Value: []byte("val2")},
-			},
-			`{"key1": "val1"}`, "json", "",
-			diff.KVChanges{
-				diff.NewRemove("key2", "val2"),
-			},
-			true,
-		},
-		{
-			api.KVPairs{
-				&api.KVPair{Key: "key1", Value: []byte("val1")},
-				&api.KVPair{Key: "key2", Value: []byte("val")},
-			},
-			`{"key1": "val1", "key2": "val2"}`, "json", "",
-			diff.KVChanges{
-				diff.NewUpdate("key2", "val", "val2"),
-			},
-			true,
-		},
-		{
-			api.KVPairs{
-				&api.KVPair{Key: "key", Value: []byte("val")},
-				&api.KVPair{Key: "key1", Value: []byte("val1")},
-				&api.KVPair{Key: "key2", Value: []byte("val")},
-			},
-			`{"key1": "val1", "key2": "val2", "key3": "val3"}`, "json", "",
-			diff.KVChanges{
-				diff.NewRemove("key", "val"),
-				diff.NewUpdate("key2", "val", "val2"),
-				diff.NewAdd("key3", "val3"),
-			},
-			true,
-		},
-		{
-			api.KVPairs{
-				&api.KVPair{Key: "key", Value: []byte("val")},
-				&api.KVPair{Key: "key1", Value: []byte("val1")},
-				&api.KVPair{Key: "key2", Value: []byte("val")},
-			},
-			`{"key1": "val1", "key2": "val2", "key3": "val3"}`, "json", "key2",
-			diff.KVChanges{
-				diff.NewUpdate("key2", "val", "val2"),
-			},
-			true,
-		},
-		{
-			api.KVPairs{
-				&api.KVPair{Key: "key1", Value: []byte("val1")},
-				&api.KVPair{Key: "key3/ignoredSubKey", Value: []byte("whatever")},
-				&api.KVPair{Key: "ignoredKey", Value: []byte("whatever")},
-				&api.KVPair{Key: "ignoredFolder/key1", Value: []byte("whatever")},
-				&api.KVPair{Key: "ignoredFolder/key2", Value: []byte("whatever")},
-			},
-			`{
-				"key1": "val1",
-				"key2": "val2",
-				"key3": {
-					"_value": "val3",
-					"ignoredSubKey": "_ignore",
-					"subKey": {
-						"_value": "_ignore",
-						"key3SubKey": "whatever"
-					}
-				},
-				"ignoredKey": "_ignore",
-				"ignoredFolder": "_ignore"
-			}`,
-			"json", "",
-			diff.KVChanges{
-				diff.NewAdd("key2", "val2"),
-				diff.NewAdd("key3/", "val3"),
-			},
-			true,
-		},
-	}
-
-	for i, tc := range testCases {
-		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
-			ch, err := getChanges(tc.pairs, []byte(tc.config), tc.format, tc.key, DefaultIgnoreVal)
-
-			if tc.ok != (err == nil) {
-				if err != nil {
-					t.Fatal(err)
-				} else {
-					t.Fatal("Get should have failed but haven't")
-				}
-			}
-
-			if tc.ok && diff.Diff(ch, false) != diff.Diff(tc.ch, false) {
-				t.Errorf("Got `%v`; want `%v`", ch, tc.ch)
-			}
-		})
-	}
-}
@@ -0,0 +1,237 @@
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/miracl/casper"
+	"github.com/miracl/casper/consul"
+	"github.com/miracl/casper/diff"
+	"github.com/pkg/errors"
+)
+
+// DefaultIgnoreVal is the default value that need to be set for a key to be
+// ignored.
+const DefaultIgnoreVal = "_ignore"
+
+// folderValFile is the name of the file that keeps the value of a folder.
+const folderValFile = "_value"
+
+// Storage is an implementation of the storage interface that stores each
+// key in a separate file under a root directory. Nested keys are stored in
+// subdirectories.
+type Storage struct {
+	root      string
+	ignoreVal string
+	lists     consul.ListMode
+}
+
+// New returns new directory storage. The address is the path to the root
+// directory with optional ignore and lists query parameters:
+//
+//	config/?ignore=_ignore&lists=json
+func New(addr string) (*Storage, error) {
+	root, query := addr, ""
+	if i := strings.LastIndex(addr, "?"); i >= 0 {
+		root, query = addr[:i], addr[i+1:]
+	}
+
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing directory address %v failed", addr)
+	}
+
+	lists, err := consul.ParseListMode(q.Get("lists"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing directory address %v failed", addr)
+	}
+
+	ignore := q.Get("ignore")
+	if ignore == "" {
+		ignore = DefaultIgnoreVal
+	}
+
+	return &Storage{root: root, ignoreVal: ignore, lists: lists}, nil
+}
+
+func (s Storage) String(format string) (string, error) {
+	pairs, err := s.pairs()
+	if err != nil {
+		return "", err
+	}
+
+	return consul.KVPairsToString(pairs, format, s.lists), nil
+}
+
+// GetChanges returns changes between the config and the Storage content.
+func (s Storage) GetChanges(config []byte, format, key string) (casper.Changes, error) {
+	pairs, err := s.pairs()
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := consul.KVChanges(pairs, config, format, key, s.ignoreVal, s.lists)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range changes {
+		if _, err := s.path(c.Key()); err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+// Lists returns how the storage flattens the lists of the config.
+func (s Storage) Lists() consul.ListMode {
+	return s.lists
+}
+
+// Diff returns the visual representation of the changes.
+func (Storage) Diff(cs casper.Changes, pretty bool) string {
+	return diff.Diff(cs.(diff.KVChanges), pretty)
+}
+
+// Push changes to the storage. Removals are applied first so a key can
+// change from a value to a folder and vice versa.
+func (s Storage) Push(cs casper.Changes) error {
+	// sort a copy so the changes of the caller are not reordered
+	changes := append(diff.KVChanges{}, cs.(diff.KVChanges)...)
+	sort.SliceStable(changes, func(i, j int) bool {
+		_, ri := changes[i].(*diff.Remove)
+		_, rj := changes[j].(*diff.Remove)
+		return ri && !rj
+	})
+
+	for _, ci := range changes {
+		if err := s.push(ci); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s Storage) push(change diff.KVChange) error {
+	path, err := s.path(change.Key())
+	if err != nil {
+		return err
+	}
+
+	switch c := change.(type) {
+	case *diff.Add:
+		return writeFile(path, c.Val())
+	case *diff.Update:
+		return writeFile(path, c.NewVal())
+	case *diff.Remove:
+		if err := os.Remove(path); err != nil {
+			return errors.Wrapf(err, "removing file %v failed", path)
+		}
+		return s.removeEmptyDirs(filepath.Dir(path))
+	}
+
+	return fmt.Errorf("invalid change type: %T", change)
+}
+
+// pairs returns the content of the directory as key/value pairs.
+func (s Storage) pairs() (api.KVPairs, error) {
+	pairs := api.KVPairs{}
+	if _, err := os.Stat(s.root); os.IsNotExist(err) {
+		return pairs, nil
+	}
+
+	err := filepath.Walk(s.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+
+		val, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "reading file %v failed", path)
+		}
+
+		key := filepath.ToSlash(rel)
+		if filepath.Base(rel) == folderValFile {
+			key = strings.TrimSuffix(key, folderValFile)
+		}
+
+		pairs = append(pairs, &api.KVPair{Key: key, Value: val})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading directory %v failed", s.root)
+	}
+
+	return pairs, nil
+}
+
+// path returns the file path for a key. The keys with the path outside the
+// root, e.g. with .. parts, are rejected.
+func (s Storage) path(key string) (string, error) {
+	if strings.HasSuffix(key, "/") {
+		key += folderValFile
+	}
+
+	path := filepath.Join(s.root, filepath.FromSlash(key))
+	rel, err := filepath.Rel(s.root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("key %v is outside the directory %v", key, s.root)
+	}
+
+	return path, nil
+}
+
+// removeEmptyDirs removes dir and its parents up to the root if they are
+// empty.
+func (s Storage) removeEmptyDirs(dir string) error {
+	root, err := filepath.Abs(s.root)
+	if err != nil {
+		return errors.Wrapf(err, "getting absolute path of %v failed", s.root)
+	}
+
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return errors.Wrapf(err, "getting absolute path of %v failed", dir)
+	}
+
+	prefix := strings.TrimSuffix(root, string(filepath.Separator)) + string(filepath.Separator)
+	for strings.HasPrefix(dir, prefix) {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return errors.Wrapf(err, "reading directory %v failed", dir)
+		}
+
+		if len(files) > 0 {
+			return nil
+		}
+
+		if err := os.Remove(dir); err != nil {
+			return errors.Wrapf(err, "removing directory %v failed", dir)
+		}
+
+		dir = filepath.Dir(dir)
+	}
+
+	return nil
+}
+
+func writeFile(path, val string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrapf(err, "creating directory for %v failed", path)
+	}
+
+	return errors.Wrapf(ioutil.WriteFile(path, []byte(val), 0644), "writing file %v failed", path)
+}
@@ -0,0 +1,351 @@
+package dir
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/miracl/casper/diff"
+)
+
+// It is defined in each package so you can run `go test ./...`
+var full = flag.Bool("full", false, "Run all tests including integration")
+
+func TestDirStorageString(t *testing.T) {
+	testCases := []struct {
+		files map[string]string
+		str   string
+	}{
+		{nil, "{}"},
+		{
+			map[string]string{
+				"key1":          "val1",
+				"key2/_value":   "val2",
+				"key2/sub/key3": "val3",
+			},
+			`{"key1":"val1","key2":{"_value":"val2","sub":{"key3":"val3"}}}`,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			root := prepareTmpDir(t, tc.files)
+			defer os.RemoveAll(root)
+
+			s, err := New(filepath.Join(root, "config"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			str, err := s.String("jsonraw")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if str != tc.str {
+				t.Errorf("Got `%v`; want `%v`", str, tc.str)
+			}
+		})
+	}
+}
+
+func TestDirStoragePush(t *testing.T) {
+	testCases := []struct {
+		query  string
+		files  map[string]string
+		config string
+		diff   string
+		exp    map[string]string
+	}{
+		{
+			"",
+			nil,
+			`{"key1":"val1","key2":{"_value":"val2","sub":{"key3":"val3"}}}`,
+			"" +
+				"+key1=val1\n" +
+				"+key2/=val2\n" +
+				"+key2/sub/key3=val3\n",
+			map[string]string{
+				"key1":          "val1",
+				"key2/_value":   "val2",
+				"key2/sub/key3": "val3",
+			},
+		},
+		{
+			"",
+			map[string]string{
+				"key1":          "val1",
+				"key2/_value":   "val2",
+				"key2/sub/key3": "val3",
+				"key4":          "val4",
+			},
+			`{"key1":"val1a","key2":"val2","key4":"_ignore","key5":"_ignore"}`,
+			"" +
+				"-key1=val1\n" +
+				"+key1=val1a\n" +
+				"+key2=val2\n" +
+				"-key2/=val2\n" +
+				"-key2/sub/key3=val3\n",
+			map[string]string{
+				"key1": "val1a",
+				"key2": "val2",
+				"key4": "val4",
+			},
+		},
+		{
+			"",
+			map[string]string{
+				"key1": "val1",
+			},
+			`{"key1":{"sub":"val1"}}`,
+			"" +
+				"-key1=val1\n" +
+				"+key1/sub=val1\n",
+			map[string]string{
+				"key1/sub": "val1",
+			},
+		},
+		{
+			"?ignore=_skip",
+			map[string]string{
+				"key1": "val1",
+				"key2": "val2",
+			},
+			`{"key1":"_skip","key3":"_ignore"}`,
+			"" +
+				"-key2=val2\n" +
+				"+key3=_ignore\n",
+			map[string]string{
+				"key1": "val1",
+				"key3": "_ignore",
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			root := prepareTmpDir(t, tc.files)
+			defer os.RemoveAll(root)
+
+			s, err := New(filepath.Join(root, "config") + tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cs, err := s.GetChanges([]byte(tc.config), "json", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			plain := s.Diff(cs, false)
+			if plain != tc.diff {
+				t.Errorf("Got `%v`; want `%v`", plain, tc.diff)
+			}
+
+			order := append(diff.KVChanges{}, cs.(diff.KVChanges)...)
+
+			if err := s.Push(cs); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(cs, order) {
+				t.Error("Push reordered the changes")
+			}
+
+			files := readDir(t, filepath.Join(root, "config"))
+			if !reflect.DeepEqual(files, tc.exp) {
+				t.Errorf("Got %v; want %v", files, tc.exp)
+			}
+
+			cs, err = s.GetChanges([]byte(tc.config), "json", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cs.Len() != 0 {
+				t.Errorf("Got changes after push: %v", s.Diff(cs, false))
+			}
+		})
+	}
+}
+
+func TestDirStorageLists(t *testing.T) {
+	testCases := []struct {
+		query string
+		exp   map[string]string
+		str   string
+		ok    bool
+	}{
+		{"", map[string]string{"hosts/0": "a", "hosts/1": "b"}, `{"hosts":["a","b"]}`, true},
+		{"?lists=json", map[string]string{"hosts": `["a","b"]`}, `{"hosts":["a","b"]}`, true},
+		{"?lists=join", map[string]string{"hosts": "a,b"}, `{"hosts":"a,b"}`, true},
+		{"?lists=other", nil, "", false},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			root := prepareTmpDir(t, nil)
+			defer os.RemoveAll(root)
+
+			s, err := New(filepath.Join(root, "config") + tc.query)
+			if tc.ok != (err == nil) {
+				if err != nil {
+					t.Fatal(err)
+				} else {
+					t.Fatal("Should fail")
+				}
+			}
+
+			if !tc.ok {
+				return
+			}
+
+			cs, err := s.GetChanges([]byte(`{"hosts":["a","b"]}`), "json", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := s.Push(cs); err != nil {
+				t.Fatal(err)
+			}
+
+			if files := readDir(t, filepath.Join(root, "config")); !reflect.DeepEqual(files, tc.exp) {
+				t.Errorf("Got %v; want %v", files, tc.exp)
+			}
+
+			str, err := s.String("jsonraw")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if str != tc.str {
+				t.Errorf("Got `%v`; want `%v`", str, tc.str)
+			}
+		})
+	}
+}
+
+func TestDirStorageKeyOutsideRoot(t *testing.T) {
+	testCases := []string{
+		`{"..":{"escape":"val"}}`,
+		`{"sub":{"..":{"..":{"escape":"val"}}}}`,
+		`{"..":"val"}`,
+	}
+
+	for i, config := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			root := prepareTmpDir(t, nil)
+			defer os.RemoveAll(root)
+
+			s, err := New(filepath.Join(root, "config"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := s.GetChanges([]byte(config), "json", ""); err == nil || !strings.Contains(err.Error(), "is outside the directory") {
+				t.Errorf("Got %v; want key outside the directory error", err)
+			}
+
+			if err := s.Push(diff.KVChanges{diff.NewAdd("../escape", "val")}); err == nil {
+				t.Error("Push should fail")
+			}
+
+			if _, err := os.Stat(filepath.Join(root, "escape")); !os.IsNotExist(err) {
+				t.Errorf("File outside the directory is written: %v", err)
+			}
+		})
+	}
+}
+
+func TestDirStorageRelativeRoot(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	root := prepareTmpDir(t, nil)
+	defer os.RemoveAll(root)
+
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, config := range []string{`{"key1":"val1","key2":{"sub":{"key3":"val3"}}}`, `{"key1":"val1"}`} {
+		cs, err := s.GetChanges([]byte(config), "json", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := s.Push(cs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the empty directories of the removed keys are pruned
+	exp := map[string]string{"key1": "val1"}
+	if files := readDir(t, "."); !reflect.DeepEqual(files, exp) {
+		t.Errorf("Got %v; want %v", files, exp)
+	}
+}
+
+// prepareTmpDir creates temporary directory with config subdirectory
+// containing the given files.
+func prepareTmpDir(t *testing.T, files map[string]string) string {
+	root, err := ioutil.TempDir("", "casper")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range files {
+		path := filepath.Join(root, "config", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
+// readDir returns the content of all files and checks there are no empty
+// directories left.
+func readDir(t *testing.T, root string) map[string]string {
+	files := map[string]string{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			entries, err := ioutil.ReadDir(path)
+			if err == nil && len(entries) == 0 {
+				t.Errorf("Empty directory %v left", path)
+			}
+			return err
+		}
+
+		rel, _ := filepath.Rel(root, path)
+		data, err := ioutil.ReadFile(path)
+		files[filepath.ToSlash(rel)] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return files
+}
@@ -0,0 +1,328 @@
+package dotenv
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/miracl/casper"
+	"github.com/miracl/casper/consul"
+	"github.com/miracl/casper/diff"
+	"github.com/miracl/casper/dotenv"
+	"github.com/pkg/errors"
+)
+
+// DefaultIgnoreVal is the default value that need to be set for a key to be
+// ignored.
+const DefaultIgnoreVal = "_ignore"
+
+// Styles of the file.
+const (
+	// EnvStyle is .env file with KEY=value lines. The values are quoted
+	// when needed.
+	EnvStyle = "env"
+	// PropertiesStyle is Java .properties file with key=value lines. The
+	// special characters in the values are escaped.
+	PropertiesStyle = "properties"
+)
+
+// Storage is an implementation of the storage interface that stores in
+// .env or .properties file. The config is flattened like for Consul and the
+// nested keys are joined with sep, e.g. db/host becomes DB_HOST.
+type Storage struct {
+	path      string
+	style     string
+	sep       string
+	upper     bool
+	ignoreVal string
+	lists     consul.ListMode
+}
+
+// New returns new dotenv storage. The address is the path to the file with
+// optional style, sep, upper, ignore and lists query parameters:
+//
+//	.env?style=env&sep=_&upper=true
+//	application.properties?style=properties&sep=.&upper=false
+func New(addr string) (*Storage, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing dotenv address %v failed", addr)
+	}
+
+	if u.Path == "" {
+		return nil, fmt.Errorf("missing file path in %v", addr)
+	}
+
+	q := u.Query()
+	s := &Storage{
+		path:      u.Path,
+		style:     q.Get("style"),
+		ignoreVal: q.Get("ignore"),
+	}
+
+	switch s.style {
+	case "", EnvStyle:
+		s.style, s.sep, s.upper = EnvStyle, "_", true
+	case PropertiesStyle:
+		s.sep, s.upper = ".", false
+	default:
+		return nil, fmt.Errorf("invalid dotenv style '%v'", s.style)
+	}
+
+	if sep, ok := q["sep"]; ok {
+		s.sep = sep[0]
+	}
+
+	if upper := q.Get("upper"); upper != "" {
+		s.upper, err = strconv.ParseBool(upper)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing upper %v failed", upper)
+		}
+	}
+
+	if s.ignoreVal == "" {
+		s.ignoreVal = DefaultIgnoreVal
+	}
+
+	if s.lists, err = consul.ParseListMode(q.Get("lists")); err != nil {
+		return nil, errors.Wrapf(err, "parsing dotenv address %v failed", addr)
+	}
+
+	return s, nil
+}
+
+func (s Storage) String(format string) (string, error) {
+	vars, err := s.read()
+	if err != nil {
+		return "", err
+	}
+
+	pairs := api.KVPairs{}
+	for k, v := range vars {
+		pairs = append(pairs, &api.KVPair{Key: s.configKey(k), Value: []byte(v)})
+	}
+
+	return consul.KVPairsToString(pairs, format, s.lists), nil
+}
+
+// GetChanges returns changes between the config and the Storage content.
+// The changes are per key of the file. The key is a flattened config key,
+// e.g. db/host for DB_HOST.
+func (s Storage) GetChanges(config []byte, format, key string) (casper.Changes, error) {
+	cur, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	vars, err := s.vars(config, format)
+	if err != nil {
+		return nil, err
+	}
+
+	ignored := []string{}
+	for k, v := range vars {
+		if v == s.ignoreVal {
+			ignored = append(ignored, k)
+		}
+	}
+
+	isIgnored := func(k string) bool {
+		for _, i := range ignored {
+			if k == i || strings.HasPrefix(k, i+s.sep) {
+				return true
+			}
+		}
+		return false
+	}
+
+	kvChanges := diff.KVChanges{}
+	for k, v := range cur {
+		if _, ok := vars[k]; !ok && !isIgnored(k) {
+			kvChanges = append(kvChanges, diff.NewRemove(k, v))
+		}
+	}
+
+	for k, v := range vars {
+		if isIgnored(k) {
+			continue
+		}
+
+		curVal, ok := cur[k]
+		switch {
+		case !ok:
+			kvChanges = append(kvChanges, diff.NewAdd(k, v))
+		case curVal != v:
+			kvChanges = append(kvChanges, diff.NewUpdate(k, curVal, v))
+		}
+	}
+
+	// the key is a config key like for the other storages, e.g. db/host
+	if key != "" {
+		filtered := diff.KVChanges{}
+		for _, c := range kvChanges {
+			if s.configKey(c.Key()) == key {
+				filtered = append(filtered, c)
+			}
+		}
+		kvChanges = filtered
+	}
+
+	sort.Slice(kvChanges, func(i, j int) bool { return kvChanges[i].Key() < kvChanges[j].Key() })
+
+	keys := diff.KVChanges{}
+	for _, c := range kvChanges {
+		switch change := c.(type) {
+		case *diff.Add:
+			keys = append(keys, diff.NewAdd(s.configKey(change.Key()), change.Val()))
+		case *diff.Update:
+			keys = append(keys, diff.NewUpdate(s.configKey(change.Key()), change.Val(), change.NewVal()))
+		case *diff.Remove:
+			keys = append(keys, diff.NewRemove(s.configKey(change.Key()), change.Val()))
+		}
+	}
+
+	return &changes{kvChanges, cur, keys}, nil
+}
+
+// Lists returns how the storage flattens the lists of the config.
+func (s Storage) Lists() consul.ListMode {
+	return s.lists
+}
+
+// Diff returns the visual representation of the changes.
+func (Storage) Diff(cs casper.Changes, pretty bool) string {
+	return diff.Diff(cs.(*changes).KVChanges, pretty)
+}
+
+// Push changes to the storage. The file is rewritten atomically with the
+// keys sorted. Comments in the existing file are not kept.
+func (s Storage) Push(cs casper.Changes) error {
+	c := cs.(*changes)
+
+	vars := map[string]string{}
+	for k, v := range c.cur {
+		vars[k] = v
+	}
+
+	for _, ci := range c.KVChanges {
+		switch change := ci.(type) {
+		case *diff.Add:
+			vars[change.Key()] = change.Val()
+		case *diff.Update:
+			vars[change.Key()] = change.NewVal()
+		case *diff.Remove:
+			delete(vars, change.Key())
+		}
+	}
+
+	return s.write(vars)
+}
+
+// configKey returns the flattened config key of the key in the file.
+func (s Storage) configKey(key string) string {
+	if s.upper {
+		key = strings.ToLower(key)
+	}
+	if s.sep != "" {
+		key = strings.Replace(key, s.sep, "/", -1)
+	}
+	return key
+}
+
+// vars returns the flattened config with the keys of the file.
+func (s Storage) vars(config []byte, format string) (map[string]string, error) {
+	flat, err := consul.GetChanges(nil, config, format, s.lists)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := map[string]string{}
+	origin := map[string]string{}
+	for _, c := range flat {
+		k := strings.Replace(strings.TrimSuffix(c.Key, "/"), "/", s.sep, -1)
+		if s.upper {
+			k = strings.ToUpper(k)
+		}
+
+		if o, ok := origin[k]; ok {
+			return nil, fmt.Errorf("keys %v and %v are both stored as %v", o, c.Key, k)
+		}
+		origin[k] = c.Key
+		vars[k] = c.NewVal
+	}
+
+	return vars, nil
+}
+
+// read returns the variables in the file. Missing file is treated as empty.
+func (s Storage) read() (map[string]string, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]string{}, nil
+		}
+		return nil, errors.Wrapf(err, "reading file %v failed", s.path)
+	}
+
+	if s.style == PropertiesStyle {
+		return dotenv.ParseProperties(data), nil
+	}
+
+	vars, err := dotenv.ParseEnv(data)
+	return vars, errors.Wrapf(err, "parsing file %v failed", s.path)
+}
+
+// write replaces the file with the variables. The content is written in a
+// temporary file in the same directory that is renamed over the file.
+func (s Storage) write(vars map[string]string) error {
+	var data []byte
+	if s.style == PropertiesStyle {
+		data = dotenv.FormatProperties(vars)
+	} else {
+		data = dotenv.FormatEnv(vars)
+	}
+
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(s.path); err == nil {
+		mode = fi.Mode()
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(s.path), "."+filepath.Base(s.path))
+	if err != nil {
+		return errors.Wrapf(err, "creating temporary file for %v failed", s.path)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "writing to file %v failed", f.Name())
+	}
+
+	if err := f.Close(); err != nil {
+		return errors.Wrapf(err, "writing to file %v failed", f.Name())
+	}
+
+	if err := os.Chmod(f.Name(), mode); err != nil {
+		return errors.Wrapf(err, "setting mode of %v failed", f.Name())
+	}
+
+	return errors.Wrapf(os.Rename(f.Name(), s.path), "replacing file %v failed", s.path)
+}
+
+type changes struct {
+	diff.KVChanges
+	cur map[string]string
+	// keys are the changes with the keys of the config
+	keys diff.KVChanges
+}
+
+// KeyChanges returns the changes of the keys in the config.
+func (c changes) KeyChanges() diff.KVChanges {
+	return c.keys
+}
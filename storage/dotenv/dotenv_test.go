@@ -0,0 +1,225 @@
+package dotenv
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// It is defined in each package so you can run `go test ./...`
+var full = flag.Bool("full", false, "Run all tests including integration")
+
+func TestNewDotenvStorage(t *testing.T) {
+	testCases := []struct {
+		addr  string
+		style string
+		sep   string
+		upper bool
+		ok    bool
+	}{
+		{".env", EnvStyle, "_", true, true},
+		{"config/app.properties?style=properties", PropertiesStyle, ".", false, true},
+		{".env?sep=__&upper=false", EnvStyle, "__", false, true},
+		{"app.properties?style=properties&sep=&upper=1", PropertiesStyle, "", true, true},
+		{".env?lists=json", EnvStyle, "_", true, true},
+		{"", "", "", false, false},
+		{".env?style=ini", "", "", false, false},
+		{".env?upper=maybe", "", "", false, false},
+		{".env?lists=other", "", "", false, false},
+		{"%zz", "", "", false, false},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			s, err := New(tc.addr)
+			if tc.ok != (err == nil) {
+				if err != nil {
+					t.Fatal(err)
+				} else {
+					t.Fatal("Should fail")
+				}
+			}
+
+			if !tc.ok {
+				return
+			}
+
+			if s.style != tc.style || s.sep != tc.sep || s.upper != tc.upper {
+				t.Errorf("Got %v, %v, %v; want %v, %v, %v", s.style, s.sep, s.upper, tc.style, tc.sep, tc.upper)
+			}
+		})
+	}
+}
+
+func TestDotenvStorageString(t *testing.T) {
+	testCases := []struct {
+		query   string
+		content string
+		str     string
+	}{
+		{"", "DB_HOST=host\nDB=val\nPORT=80\n", `{"db":{"_value":"val","host":"host"},"port":"80"}`},
+		{"?style=properties", "db.host=host\nport=80\n", `{"db":{"host":"host"},"port":"80"}`},
+		{"", "", `{}`},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			path, cleanup := prepareFile(t, tc.content)
+			defer cleanup()
+
+			s, err := New(path + tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			str, err := s.String("jsonraw")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if str != tc.str {
+				t.Errorf("Got `%v`; want `%v`", str, tc.str)
+			}
+		})
+	}
+}
+
+func TestDotenvStoragePush(t *testing.T) {
+	testCases := []struct {
+		query   string
+		content string
+		config  string
+		key     string
+		diff    string
+		exp     string
+	}{
+		{
+			"",
+			"# removed comment\nDB_HOST=old\nDB_USER=user\nSECRET=keep\nOTHER=val\n",
+			`{"db":{"host":"new","port":5432},"secret":"_ignore","name":"my app"}`,
+			"",
+			"" +
+				"-DB_HOST=old\n" +
+				"+DB_HOST=new\n" +
+				"+DB_PORT=5432\n" +
+				"-DB_USER=user\n" +
+				"+NAME=my app\n" +
+				"-OTHER=val\n",
+			"DB_HOST=new\nDB_PORT=5432\nNAME=\"my app\"\nSECRET=keep\n",
+		},
+		{
+			"?style=properties",
+			"db.host=old\ndb.user=user\n",
+			`{"db":{"host":"new","port":5432}}`,
+			"db/host",
+			"" +
+				"-db.host=old\n" +
+				"+db.host=new\n",
+			"db.host=new\ndb.user=user\n",
+		},
+		{
+			"",
+			"DB_HOST=old\nDB_USER=user\n",
+			`{"db":{"host":"new","port":5432}}`,
+			"db/host",
+			"" +
+				"-DB_HOST=old\n" +
+				"+DB_HOST=new\n",
+			"DB_HOST=new\nDB_USER=user\n",
+		},
+		{
+			"",
+			"DB_HOST=old\n",
+			`{"db":{"host":"new"}}`,
+			"DB_HOST",
+			"",
+			"DB_HOST=old\n",
+		},
+		{
+			"",
+			"",
+			`{"db":{"_value":"main","host":"host"}}`,
+			"",
+			"" +
+				"+DB=main\n" +
+				"+DB_HOST=host\n",
+			"DB=main\nDB_HOST=host\n",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			path, cleanup := prepareFile(t, tc.content)
+			defer cleanup()
+
+			s, err := New(path + tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cs, err := s.GetChanges([]byte(tc.config), "json", tc.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			diff := s.Diff(cs, false)
+			if diff != tc.diff {
+				t.Errorf("Got `%v`; want `%v`", diff, tc.diff)
+			}
+
+			if err := s.Push(cs); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(data) != tc.exp {
+				t.Errorf("Got `%s`; want `%v`", data, tc.exp)
+			}
+
+			// no temporary files are left
+			files, _ := ioutil.ReadDir(filepath.Dir(path))
+			if len(files) != 1 {
+				t.Errorf("Got %v files; want 1", len(files))
+			}
+		})
+	}
+}
+
+func TestDotenvStorageKeyCollision(t *testing.T) {
+	path, cleanup := prepareFile(t, "")
+	defer cleanup()
+
+	s, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetChanges([]byte(`{"db":{"host":"a"},"DB_HOST":"b"}`), "json", ""); err == nil {
+		t.Error("Should fail")
+	}
+}
+
+// prepareFile creates the file in a temporary directory. Empty content means
+// that the file doesn't exist.
+func prepareFile(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "casper")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "config")
+	if content != "" {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return path, func() { os.RemoveAll(dir) }
+}
@@ -0,0 +1,206 @@
+package etcd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+)
+
+// MaxTxnOps is the default limit of the operations in one etcd transaction
+// (--max-txn-ops).
+const MaxTxnOps = 128
+
+// invalidTokenMsg is the error message of the requests with expired or
+// revoked auth token.
+const invalidTokenMsg = "invalid auth token"
+
+// client is a minimal etcd v3 KV client that talks to the JSON gRPC gateway.
+type client struct {
+	endpoint string
+	user     *url.Userinfo
+	token    string
+	http     *http.Client
+}
+
+func newClient(endpoint string, user *url.Userinfo) *client {
+	return &client{endpoint: endpoint, user: user, http: http.DefaultClient}
+}
+
+type keyValue struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+type rangeRequest struct {
+	Key      []byte `json:"key"`
+	RangeEnd []byte `json:"range_end"`
+}
+
+type rangeResponse struct {
+	Kvs []keyValue `json:"kvs"`
+}
+
+type deleteRangeRequest struct {
+	Key []byte `json:"key"`
+}
+
+type requestOp struct {
+	RequestPut         *keyValue           `json:"request_put,omitempty"`
+	RequestDeleteRange *deleteRangeRequest `json:"request_delete_range,omitempty"`
+}
+
+type txnRequest struct {
+	Success []requestOp `json:"success"`
+}
+
+type authRequest struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+type authResponse struct {
+	Token string `json:"token"`
+}
+
+type errorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// List returns all pairs with keys starting with prefix.
+func (c *client) List(prefix string) (api.KVPairs, error) {
+	req := rangeRequest{[]byte(prefix), prefixEnd(prefix)}
+	if prefix == "" {
+		req.Key = []byte{0}
+	}
+
+	res := rangeResponse{}
+	if err := c.call("/v3/kv/range", req, &res); err != nil {
+		return nil, err
+	}
+
+	pairs := make(api.KVPairs, len(res.Kvs))
+	for i, kv := range res.Kvs {
+		pairs[i] = &api.KVPair{Key: string(kv.Key), Value: kv.Value}
+	}
+
+	return pairs, nil
+}
+
+// Txn puts and deletes the given keys in transactions of at most MaxTxnOps
+// operations. If a transaction fails the previous ones stay applied.
+func (c *client) Txn(puts api.KVPairs, dels []string) error {
+	ops := []requestOp{}
+	for _, p := range puts {
+		ops = append(ops, requestOp{RequestPut: &keyValue{[]byte(p.Key), p.Value}})
+	}
+	for _, d := range dels {
+		ops = append(ops, requestOp{RequestDeleteRange: &deleteRangeRequest{[]byte(d)}})
+	}
+
+	for start := 0; start < len(ops); start += MaxTxnOps {
+		end := start + MaxTxnOps
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		if err := c.call("/v3/kv/txn", txnRequest{ops[start:end]}, &struct{}{}); err != nil {
+			if start == 0 {
+				return err
+			}
+			return errors.Wrapf(err, "applying changes %v-%v of %v failed, the first %v are applied", start+1, end, len(ops), start)
+		}
+	}
+
+	return nil
+}
+
+func (c *client) authenticate() error {
+	password, _ := c.user.Password()
+	res := authResponse{}
+	if err := c.post("/v3/auth/authenticate", authRequest{c.user.Username(), password}, &res); err != nil {
+		return errors.Wrap(err, "etcd authentication failed")
+	}
+
+	c.token = res.Token
+	return nil
+}
+
+func (c *client) call(path string, req, res interface{}) error {
+	if c.user != nil && c.token == "" {
+		if err := c.authenticate(); err != nil {
+			return err
+		}
+	}
+
+	err := c.post(path, req, res)
+	if c.user == nil || err == nil || !strings.Contains(err.Error(), invalidTokenMsg) {
+		return err
+	}
+
+	// the token is expired, authenticate again and retry once
+	c.token = ""
+	if err := c.authenticate(); err != nil {
+		return err
+	}
+
+	return c.post(path, req, res)
+}
+
+func (c *client) post(path string, req, res interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	r, err := http.NewRequest(http.MethodPost, c.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		r.Header.Set("Authorization", c.token)
+	}
+
+	resp, err := c.http.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "reading etcd response failed")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		e := errorResponse{}
+		if err := json.Unmarshal(data, &e); err == nil && e.Message != "" {
+			return fmt.Errorf("etcd: %v", e.Message)
+		}
+		return fmt.Errorf("etcd: unexpected status %v", resp.Status)
+	}
+
+	return errors.Wrap(json.Unmarshal(data, res), "parsing etcd response failed")
+}
+
+// prefixEnd returns the range end for listing all keys with the prefix.
+func prefixEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+
+	// no prefix or all 0xff - list to the end of the keyspace
+	return []byte{0}
+}
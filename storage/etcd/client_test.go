@@ -0,0 +1,253 @@
+package etcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/miracl/casper/consul"
+)
+
+// gatewayMock is an in-memory stand-in of the etcd JSON gateway.
+type gatewayMock struct {
+	kv    map[string]string
+	token string
+	auths int
+	txns  int
+}
+
+func (g *gatewayMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/v3/auth/authenticate" {
+		req := authRequest{}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Name != "user" || req.Password != "pass" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"authentication failed","message":"authentication failed"}`)
+			return
+		}
+		g.auths++
+		json.NewEncoder(w).Encode(authResponse{g.token})
+		return
+	}
+
+	if g.token != "" && r.Header.Get("Authorization") != g.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":"invalid auth token","message":"invalid auth token"}`)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		req := rangeRequest{}
+		json.NewDecoder(r.Body).Decode(&req)
+		res := rangeResponse{}
+		for k, v := range g.kv {
+			if k >= string(req.Key) && (string(req.RangeEnd) == "\x00" || k < string(req.RangeEnd)) {
+				res.Kvs = append(res.Kvs, keyValue{[]byte(k), []byte(v)})
+			}
+		}
+		sort.Slice(res.Kvs, func(i, j int) bool { return string(res.Kvs[i].Key) < string(res.Kvs[j].Key) })
+		json.NewEncoder(w).Encode(res)
+	case "/v3/kv/txn":
+		req := txnRequest{}
+		json.NewDecoder(r.Body).Decode(&req)
+		g.txns++
+		if len(req.Success) > MaxTxnOps {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"etcdserver: too many operations in txn request","message":"etcdserver: too many operations in txn request"}`)
+			return
+		}
+		for _, op := range req.Success {
+			if op.RequestPut != nil {
+				g.kv[string(op.RequestPut.Key)] = string(op.RequestPut.Value)
+			}
+			if op.RequestDeleteRange != nil {
+				delete(g.kv, string(op.RequestDeleteRange.Key))
+			}
+		}
+		fmt.Fprint(w, `{"succeeded":true}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":"Not Found","message":"Not Found"}`)
+	}
+}
+
+func TestClient(t *testing.T) {
+	testCases := []struct {
+		token string
+		user  *url.Userinfo
+		ok    bool
+	}{
+		{"", nil, true},
+		{"secret", url.UserPassword("user", "pass"), true},
+		{"secret", url.UserPassword("user", "wrong"), false},
+		{"secret", nil, false},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			g := &gatewayMock{
+				kv: map[string]string{
+					"app/key1":  "val1",
+					"app/key2":  "val2",
+					"apps/key":  "val",
+					"other/key": "val",
+				},
+				token: tc.token,
+			}
+			srv := httptest.NewServer(g)
+			defer srv.Close()
+
+			c := newClient(srv.URL, tc.user)
+
+			pairs, err := c.List("app/")
+			if tc.ok != (err == nil) {
+				if err != nil {
+					t.Fatal(err)
+				} else {
+					t.Fatal("Should fail")
+				}
+			}
+
+			if !tc.ok {
+				return
+			}
+
+			if keys := pairKeys(pairs); keys != "app/key1,app/key2" {
+				t.Errorf("Got %v; want %v", keys, "app/key1,app/key2")
+			}
+
+			err = c.Txn(api.KVPairs{&api.KVPair{Key: "app/key3", Value: []byte("val3")}}, []string{"app/key1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pairs, err = c.List("")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if keys := pairKeys(pairs); keys != "app/key2,app/key3,apps/key,other/key" {
+				t.Errorf("Got %v; want %v", keys, "app/key2,app/key3,apps/key,other/key")
+			}
+
+			if tc.user != nil && g.auths != 1 {
+				t.Errorf("Got %v authentications; want 1", g.auths)
+			}
+		})
+	}
+}
+
+func TestClientTokenExpiry(t *testing.T) {
+	g := &gatewayMock{kv: map[string]string{"key": "val"}, token: "secret1"}
+	srv := httptest.NewServer(g)
+	defer srv.Close()
+
+	c := newClient(srv.URL, url.UserPassword("user", "pass"))
+	if _, err := c.List(""); err != nil {
+		t.Fatal(err)
+	}
+
+	// the token expires
+	g.token = "secret2"
+
+	if err := c.Txn(api.KVPairs{&api.KVPair{Key: "key", Value: []byte("new")}}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if g.kv["key"] != "new" {
+		t.Errorf("Got %v; want new", g.kv["key"])
+	}
+
+	if g.auths != 2 {
+		t.Errorf("Got %v authentications; want 2", g.auths)
+	}
+}
+
+func TestClientTxnBatches(t *testing.T) {
+	testCases := []struct {
+		puts int
+		dels int
+		txns int
+	}{
+		{1, 0, 1},
+		{MaxTxnOps, 0, 1},
+		{MaxTxnOps, 1, 2},
+		{200, 100, 3},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			g := &gatewayMock{kv: map[string]string{}}
+			for j := 0; j < tc.dels; j++ {
+				g.kv[fmt.Sprintf("old%03d", j)] = "val"
+			}
+
+			srv := httptest.NewServer(g)
+			defer srv.Close()
+
+			s := &Storage{newClient(srv.URL, nil), "", DefaultIgnoreVal, consul.IndexedLists}
+
+			config := map[string]string{}
+			for j := 0; j < tc.puts; j++ {
+				config[fmt.Sprintf("key%03d", j)] = "val"
+			}
+			data, err := json.Marshal(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cs, err := s.GetChanges(data, "json", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := s.Push(cs); err != nil {
+				t.Fatal(err)
+			}
+
+			if g.txns != tc.txns {
+				t.Errorf("Got %v transactions; want %v", g.txns, tc.txns)
+			}
+
+			if !reflect.DeepEqual(g.kv, config) {
+				t.Errorf("Got %v keys; want %v", len(g.kv), len(config))
+			}
+		})
+	}
+}
+
+func TestPrefixEnd(t *testing.T) {
+	testCases := []struct {
+		prefix string
+		end    []byte
+	}{
+		{"", []byte{0}},
+		{"app/", []byte("app0")},
+		{"a\xff", []byte("b")},
+		{"\xff\xff", []byte{0}},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			if end := prefixEnd(tc.prefix); !reflect.DeepEqual(end, tc.end) {
+				t.Errorf("Got %q; want %q", end, tc.end)
+			}
+		})
+	}
+}
+
+func pairKeys(pairs api.KVPairs) string {
+	keys := []string{}
+	for _, p := range pairs {
+		keys = append(keys, p.Key)
+	}
+	return strings.Join(keys, ",")
+}
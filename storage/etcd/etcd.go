@@ -0,0 +1,131 @@
+package etcd
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/miracl/casper"
+	"github.com/miracl/casper/consul"
+	"github.com/miracl/casper/diff"
+	"github.com/pkg/errors"
+)
+
+// DefaultIgnoreVal is the default value that need to be set for a key to be
+// ignored.
+const DefaultIgnoreVal = "_ignore"
+
+// kv is interface that the etcd client implements.
+// Defined and used mainly for testing.
+type kv interface {
+	List(prefix string) (api.KVPairs, error)
+	Txn(puts api.KVPairs, dels []string) error
+}
+
+// Storage is an implementation of the storage interface that stores in etcd
+// v3 KV. The config is flattened the same way as for Consul storage.
+type Storage struct {
+	kv        kv
+	prefix    string
+	ignoreVal string
+	lists     consul.ListMode
+}
+
+// New returns new etcd storage.
+func New(addr string) (*Storage, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing etcd address %v failed", addr)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid etcd address %v", addr)
+	}
+
+	scheme := u.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	ignore := u.Query().Get("ignore")
+	if ignore == "" {
+		ignore = DefaultIgnoreVal
+	}
+
+	lists, err := consul.ParseListMode(u.Query().Get("lists"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing etcd address %v failed", addr)
+	}
+
+	c := newClient(fmt.Sprintf("%v://%v", scheme, u.Host), u.User)
+	return &Storage{c, u.Query().Get("prefix"), ignore, lists}, nil
+}
+
+func (s Storage) String(format string) (string, error) {
+	pairs, err := s.list()
+	if err != nil {
+		return "", err
+	}
+
+	return consul.KVPairsToString(pairs, format, s.lists), nil
+}
+
+// GetChanges returns changes between the config and the Storage content.
+func (s Storage) GetChanges(config []byte, format, key string) (casper.Changes, error) {
+	pairs, err := s.list()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting key/value pairs from etcd failed")
+	}
+
+	return consul.KVChanges(pairs, config, format, key, s.ignoreVal, s.lists)
+}
+
+// Lists returns how the storage flattens the lists of the config.
+func (s Storage) Lists() consul.ListMode {
+	return s.lists
+}
+
+// Diff returns the visual representation of the changes.
+func (Storage) Diff(cs casper.Changes, pretty bool) string {
+	return diff.Diff(cs.(diff.KVChanges), pretty)
+}
+
+// Push changes to the storage. The changes are applied in a single
+// transaction unless there are more than MaxTxnOps of them.
+func (s Storage) Push(cs casper.Changes) error {
+	puts := api.KVPairs{}
+	dels := []string{}
+	for _, ci := range cs.(diff.KVChanges) {
+		switch c := ci.(type) {
+		case *diff.Add:
+			puts = append(puts, &api.KVPair{Key: s.prefix + c.Key(), Value: []byte(c.Val())})
+		case *diff.Update:
+			puts = append(puts, &api.KVPair{Key: s.prefix + c.Key(), Value: []byte(c.NewVal())})
+		case *diff.Remove:
+			dels = append(dels, s.prefix+c.Key())
+		default:
+			return fmt.Errorf("invalid change type: %T", ci)
+		}
+	}
+
+	if len(puts) == 0 && len(dels) == 0 {
+		return nil
+	}
+
+	return errors.Wrap(s.kv.Txn(puts, dels), "etcd transaction failed")
+}
+
+// list returns the pairs under the storage prefix with the prefix trimmed.
+func (s Storage) list() (api.KVPairs, error) {
+	pairs, err := s.kv.List(s.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range pairs {
+		p.Key = strings.TrimPrefix(p.Key, s.prefix)
+	}
+
+	return pairs, nil
+}
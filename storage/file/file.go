@@ -8,6 +8,8 @@ import (
 	"os"
 
 	"github.com/miracl/casper"
+	"github.com/miracl/casper/consul"
+	"github.com/miracl/casper/diff"
 	"github.com/pkg/errors"
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
@@ -33,16 +35,21 @@ func (s Storage) String(format string) (string, error) {
 }
 
 // GetChanges returns changes between the config and the Storage content.
+// Missing file is treated as empty, so the first push creates it.
 func (s Storage) GetChanges(config []byte, format, key string) (casper.Changes, error) {
 	data, err := ioutil.ReadFile(s.path)
-	if err != nil {
+	if err != nil && !os.IsNotExist(err) {
 		return nil, errors.Wrapf(err, "reading file %v failed", s.path)
 	}
 
 	if bytes.Compare(data, config) == 0 {
 		return &changes{}, nil
 	}
-	return &changes{data, config}, nil
+
+	// the keys are only used to explain the changes so the content that
+	// can't be parsed has no keys
+	keys, _ := consul.ConfigChanges(data, config, format, consul.IndexedLists)
+	return &changes{data, config, keys}, nil
 }
 
 // Diff returns the visual representation of the changes.
@@ -60,11 +67,15 @@ func (s Storage) Diff(cs casper.Changes, pretty bool) string {
 	return fmt.Sprintf("-%v\n+%v", string(c.old), string(c.new))
 }
 
-// Push changes to the storage.
+// Push changes to the storage. The file is created if it is missing and
+// its content is replaced.
 func (s Storage) Push(cs casper.Changes) error {
 	c := cs.(*changes)
+	if c.Len() == 0 {
+		return nil
+	}
 
-	f, err := os.OpenFile(s.path, os.O_WRONLY, 0777)
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return errors.Wrapf(err, "opening file %v failed", s.path)
 	}
@@ -80,8 +91,14 @@ func (s Storage) Push(cs casper.Changes) error {
 }
 
 type changes struct {
-	old []byte
-	new []byte
+	old  []byte
+	new  []byte
+	keys diff.KVChanges
+}
+
+// KeyChanges returns the changes of the keys in the config.
+func (c changes) KeyChanges() diff.KVChanges {
+	return c.keys
 }
 
 func (c changes) Len() int {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -99,6 +100,16 @@ func TestFileStoragePush(t *testing.T) {
 			`{"key": "val"}`,
 			`{"key": "val", "keyNew": "valNew"}`,
 		},
+		// shorter config doesn't leave the end of the old one
+		{
+			`{"key": "val", "keyNew": "valNew"}`,
+			`{"key": "val"}`,
+		},
+		// no changes don't truncate the file
+		{
+			`{"key": "val"}`,
+			`{"key": "val"}`,
+		},
 	}
 
 	for i, tc := range testCases {
@@ -132,6 +143,46 @@ func TestFileStoragePush(t *testing.T) {
 	}
 }
 
+func TestFileStorageMissingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "casper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	s := New(path)
+
+	// missing file is empty
+	changes, err := s.GetChanges([]byte("key: val\n"), "yaml", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plain := s.Diff(changes, false); plain != "-\n+key: val\n" {
+		t.Errorf("Got `%v`; want `-\n+key: val\n`", plain)
+	}
+
+	// the file is created on push
+	if err := s.Push(changes); err != nil {
+		t.Fatal(err)
+	}
+
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(dat) != "key: val\n" {
+		t.Errorf("Got `%v`; want `key: val\n`", string(dat))
+	}
+
+	// the directory of the file is not created
+	s = New(filepath.Join(dir, "missing", "config.yaml"))
+	if _, err := s.GetChanges([]byte("key: val\n"), "yaml", ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
 // prepareTmpFile create a file with the given content.
 func prepareTmpFile(name string, data []byte) (*os.File, error) {
 	f, err := os.Create(name)
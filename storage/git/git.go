@@ -0,0 +1,270 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/miracl/casper"
+	"github.com/miracl/casper/consul"
+	"github.com/miracl/casper/diff"
+	"github.com/miracl/casper/storage/dir"
+	"github.com/miracl/casper/storage/file"
+	"github.com/pkg/errors"
+)
+
+// Modes for storing the config in the repository.
+const (
+	// FileMode stores the whole config in a single file.
+	FileMode = "file"
+	// DirMode stores each key in a separate file like the dir storage.
+	DirMode = "dir"
+)
+
+// Storage is an implementation of the storage interface that stores in a
+// file or a directory inside a local clone of a git repository and commits
+// every push.
+type Storage struct {
+	storage casper.Storage
+	repo    string
+	path    string
+	mode    string
+	branch  string
+	remote  string
+	lists   consul.ListMode
+}
+
+// New returns new git storage. The address is the path to the local clone
+// with the following query parameters:
+//
+//	path   - path of the file or the directory inside the repository (required)
+//	mode   - file or dir, file by default
+//	branch - branch to commit on, created if missing, the current branch by default
+//	remote - remote to push the commit to, not pushed by default
+//	lists  - how lists are flattened, like for Consul storage
+//	ignore - the value of the ignored keys in dir mode, like for dir storage
+func New(addr string) (*Storage, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing git address %v failed", addr)
+	}
+
+	if u.Scheme != "" && u.Scheme != "file" {
+		return nil, fmt.Errorf("git repository %v is not local", addr)
+	}
+
+	q := u.Query()
+	s := &Storage{
+		repo:   u.Host + u.Path,
+		path:   filepath.Clean(q.Get("path")),
+		mode:   q.Get("mode"),
+		branch: q.Get("branch"),
+		remote: q.Get("remote"),
+	}
+
+	if s.repo == "" {
+		s.repo = "."
+	}
+
+	if s.lists, err = consul.ParseListMode(q.Get("lists")); err != nil {
+		return nil, errors.Wrapf(err, "parsing git address %v failed", addr)
+	}
+
+	if q.Get("path") == "" || filepath.IsAbs(s.path) || strings.HasPrefix(s.path, "..") {
+		return nil, fmt.Errorf("invalid path '%v' inside the git repository", q.Get("path"))
+	}
+
+	full := filepath.Join(s.repo, s.path)
+	switch s.mode {
+	case "", FileMode:
+		s.mode = FileMode
+		s.storage = file.New(full)
+	case DirMode:
+		dq := url.Values{}
+		for _, k := range []string{"ignore", "lists"} {
+			if v := q.Get(k); v != "" {
+				dq.Set(k, v)
+			}
+		}
+
+		s.storage, err = dir.New(full + "?" + dq.Encode())
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid git storage mode '%v'", s.mode)
+	}
+
+	if _, err := s.git("rev-parse", "--git-dir"); err != nil {
+		return nil, errors.Wrapf(err, "%v is not a git repository", s.repo)
+	}
+
+	return s, nil
+}
+
+func (s Storage) String(format string) (string, error) {
+	if err := s.checkout(false); err != nil {
+		return "", err
+	}
+
+	return s.storage.String(format)
+}
+
+// GetChanges returns changes between the config and the Storage content.
+// If branch is set and exists it is checked out first, so the changes are
+// computed against the content of the branch.
+func (s Storage) GetChanges(config []byte, format, key string) (casper.Changes, error) {
+	if err := s.checkout(false); err != nil {
+		return nil, err
+	}
+
+	cs, err := s.storage.GetChanges(config, format, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.mode == DirMode {
+		return &changes{cs, cs.(diff.KVChanges)}, nil
+	}
+
+	return &changes{cs, s.fileKeyChanges(config, format)}, nil
+}
+
+// Lists returns how the storage flattens the lists of the config.
+func (s Storage) Lists() consul.ListMode {
+	return s.lists
+}
+
+// Diff returns the visual representation of the changes.
+func (s Storage) Diff(cs casper.Changes, pretty bool) string {
+	return s.storage.Diff(cs.(*changes).Changes, pretty)
+}
+
+// Push changes to the storage. The changes are written in the working tree
+// and committed with a message listing the changed keys. If branch is set
+// the commit is created on it. The branch is created from the current HEAD
+// if it doesn't exist.
+func (s Storage) Push(cs casper.Changes) error {
+	c := cs.(*changes)
+	if c.Len() == 0 {
+		return nil
+	}
+
+	if err := s.checkout(true); err != nil {
+		return err
+	}
+
+	if err := s.storage.Push(c.Changes); err != nil {
+		return err
+	}
+
+	if _, err := s.git("add", "--all", "--", s.path); err != nil {
+		return err
+	}
+
+	if _, err := s.git("commit", "-m", commitMessage(s.path, c.keys), "--", s.path); err != nil {
+		return err
+	}
+
+	if s.remote != "" {
+		if _, err := s.git("push", s.remote, "HEAD"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkout checks out the branch if it is set. A missing branch is created
+// from the current HEAD if create is true and left alone otherwise, as its
+// content would be the same as HEAD.
+func (s Storage) checkout(create bool) error {
+	if s.branch == "" {
+		return nil
+	}
+
+	args := []string{"checkout", s.branch}
+	if _, err := s.git("rev-parse", "--verify", "--quiet", "refs/heads/"+s.branch); err != nil {
+		if !create {
+			return nil
+		}
+		args = []string{"checkout", "-b", s.branch}
+	}
+
+	_, err := s.git(args...)
+	return err
+}
+
+// fileKeyChanges returns the key changes between the file and the config.
+// The keys are only used for the commit message so if any of the contents
+// can't be parsed no keys are returned.
+func (s Storage) fileKeyChanges(config []byte, format string) diff.KVChanges {
+	data, err := ioutil.ReadFile(filepath.Join(s.repo, s.path))
+	if err != nil && !os.IsNotExist(err) {
+		return nil
+	}
+
+	keys, err := consul.ConfigChanges(data, config, format, s.lists)
+	if err != nil {
+		return nil
+	}
+
+	return keys
+}
+
+func (s Storage) git(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = s.repo
+
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.Wrapf(err, "git %v failed: %v", args[0], strings.TrimSpace(stderr.String()))
+	}
+
+	return string(out), nil
+}
+
+// commitMessage returns the commit message for the changed keys. Only the
+// keys are listed as the values can be sensitive.
+func commitMessage(path string, keys diff.KVChanges) string {
+	msg := fmt.Sprintf("Update %v\n", path)
+	if len(keys) == 0 {
+		return msg
+	}
+
+	lines := make([]string, len(keys))
+	for i, k := range keys {
+		switch k.(type) {
+		case *diff.Add:
+			lines[i] = "add " + k.Key()
+		case *diff.Update:
+			lines[i] = "update " + k.Key()
+		case *diff.Remove:
+			lines[i] = "remove " + k.Key()
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		return strings.SplitN(lines[i], " ", 2)[1] < strings.SplitN(lines[j], " ", 2)[1]
+	})
+
+	return msg + "\n" + strings.Join(lines, "\n") + "\n"
+}
+
+type changes struct {
+	casper.Changes
+	keys diff.KVChanges
+}
+
+// KeyChanges returns the changes of the keys in the config.
+func (c changes) KeyChanges() diff.KVChanges {
+	return c.keys
+}
@@ -0,0 +1,373 @@
+package git
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// It is defined in each package so you can run `go test ./...`
+var full = flag.Bool("full", false, "Run all tests including integration")
+
+func TestNewGitStorage(t *testing.T) {
+	clone, cleanup := prepareRepo(t)
+	defer cleanup()
+
+	testCases := []struct {
+		addr string
+		mode string
+		ok   bool
+	}{
+		{clone + "?path=config.yaml", FileMode, true},
+		{"file://" + clone + "?path=config/&mode=dir&branch=casper&remote=origin", DirMode, true},
+		{clone, "", false},
+		{clone + "?path=../config.yaml", "", false},
+		{clone + "?path=/etc/config.yaml", "", false},
+		{clone + "?path=config&mode=other", "", false},
+		{clone + "?path=config&mode=dir&lists=json", DirMode, true},
+		{clone + "?path=config&lists=other", "", false},
+		{"https://example.com/repo.git?path=config.yaml", "", false},
+		{os.TempDir() + "?path=config.yaml", "", false},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			s, err := New(tc.addr)
+			if tc.ok != (err == nil) {
+				if err != nil {
+					t.Fatal(err)
+				} else {
+					t.Fatal("Should fail")
+				}
+			}
+
+			if !tc.ok {
+				return
+			}
+
+			if s.mode != tc.mode {
+				t.Errorf("Got %v; want %v", s.mode, tc.mode)
+			}
+		})
+	}
+}
+
+func TestGitStoragePush(t *testing.T) {
+	testCases := []struct {
+		query   string
+		configs []string
+		files   map[string]string
+		message string
+	}{
+		{
+			"?path=config.json",
+			[]string{`{"key1":"val1","key2":"val2"}`, `{"key1":"val1a","key3":"val3"}`},
+			map[string]string{"config.json": `{"key1":"val1a","key3":"val3"}`},
+			"Update config.json\n\nupdate key1\nremove key2\nadd key3",
+		},
+		{
+			"?path=config&mode=dir",
+			[]string{`{"key1":"val1","key2":{"sub":"val2"}}`, `{"key1":"val1a","key3":"val3"}`},
+			map[string]string{"config/key1": "val1a", "config/key3": "val3"},
+			"Update config\n\nupdate key1\nremove key2/sub\nadd key3",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			clone, cleanup := prepareRepo(t)
+			defer cleanup()
+
+			s, err := New(clone + tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, config := range tc.configs {
+				push(t, s, config)
+			}
+
+			for name, content := range tc.files {
+				data, err := ioutil.ReadFile(filepath.Join(clone, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if string(data) != content {
+					t.Errorf("Got %v; want %v", string(data), content)
+				}
+			}
+
+			if _, err := os.Stat(filepath.Join(clone, "config", "key2")); !os.IsNotExist(err) {
+				t.Errorf("Removed key is not deleted: %v", err)
+			}
+
+			exp := "Update " + s.path + "\nUpdate " + s.path + "\nInitial commit"
+			if log := git(t, clone, "log", "--format=%s"); log != exp {
+				t.Errorf("Got log `%v`; want `%v`", log, exp)
+			}
+
+			if msg := git(t, clone, "log", "-1", "--format=%B"); msg != tc.message {
+				t.Errorf("Got `%v`; want `%v`", msg, tc.message)
+			}
+
+			if status := git(t, clone, "status", "--porcelain"); status != "" {
+				t.Errorf("Got uncommitted changes `%v`", status)
+			}
+
+			// no changes, no commit
+			cs, err := s.GetChanges([]byte(tc.configs[len(tc.configs)-1]), "json", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cs.Len() != 0 {
+				t.Errorf("Got changes after push: %v", s.Diff(cs, false))
+			}
+		})
+	}
+}
+
+func TestGitStoragePushBranch(t *testing.T) {
+	clone, cleanup := prepareRepo(t)
+	defer cleanup()
+
+	base := git(t, clone, "rev-parse", "--abbrev-ref", "HEAD")
+
+	s, err := New(clone + "?path=config.json&branch=casper/update&remote=origin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	push(t, s, `{"key":"val"}`)
+
+	if branch := git(t, clone, "rev-parse", "--abbrev-ref", "HEAD"); branch != "casper/update" {
+		t.Errorf("Got branch %v; want casper/update", branch)
+	}
+
+	// the commit is pushed to the remote branch
+	bare := git(t, clone, "remote", "get-url", "origin")
+	if msg := git(t, bare, "log", "-1", "--format=%s", "casper/update"); msg != "Update config.json" {
+		t.Errorf("Got `%v`; want `Update config.json`", msg)
+	}
+
+	// the base branch is not changed
+	if msg := git(t, bare, "log", "-1", "--format=%s", base); msg != "Initial commit" {
+		t.Errorf("Got `%v`; want `Initial commit`", msg)
+	}
+
+	// the branch already exists and is checked out
+	push(t, s, `{"key":"val2"}`)
+
+	// the branch already exists and another branch is checked out
+	git(t, clone, "checkout", base)
+	push(t, s, `{"key":"val3"}`)
+
+	if branch := git(t, clone, "rev-parse", "--abbrev-ref", "HEAD"); branch != "casper/update" {
+		t.Errorf("Got branch %v; want casper/update", branch)
+	}
+
+	want := "Update config.json\nUpdate config.json\nUpdate config.json\nInitial commit"
+	if log := git(t, bare, "log", "--format=%s", "casper/update"); log != want {
+		t.Errorf("Got `%v`; want `%v`", log, want)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(clone, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"key":"val3"}` {
+		t.Errorf("Got %s; want {\"key\":\"val3\"}", data)
+	}
+}
+
+func TestGitStorageBranchContent(t *testing.T) {
+	testCases := []struct {
+		query   string
+		branch  map[string]string
+		head    map[string]string
+		config  string
+		diff    string
+		files   map[string]string
+		message string
+	}{
+		{
+			"?path=config.json&branch=casper/update",
+			map[string]string{"config.json": `{"key":"branch","old":"val"}`},
+			map[string]string{"config.json": `{"key":"head"}`},
+			`{"key":"new"}`,
+			"-{\"key\":\"branch\",\"old\":\"val\"}\n+{\"key\":\"new\"}",
+			map[string]string{"config.json": `{"key":"new"}`},
+			"Update config.json\n\nupdate key\nremove old",
+		},
+		{
+			"?path=config&mode=dir&branch=casper/update",
+			map[string]string{"config/key": "branch", "config/old": "val"},
+			map[string]string{"config/other": "head"},
+			`{"key":"new"}`,
+			"-key=branch\n+key=new\n-old=val\n",
+			map[string]string{"config/key": "new"},
+			"Update config\n\nupdate key\nremove old",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			clone, cleanup := prepareRepo(t)
+			defer cleanup()
+
+			base := git(t, clone, "rev-parse", "--abbrev-ref", "HEAD")
+			git(t, clone, "checkout", "-b", "casper/update")
+			commitFiles(t, clone, tc.branch)
+			git(t, clone, "checkout", base)
+			commitFiles(t, clone, tc.head)
+
+			s, err := New(clone + tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cs, err := s.GetChanges([]byte(tc.config), "json", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := s.Diff(cs, false); diff != tc.diff {
+				t.Errorf("Got `%v`; want `%v`", diff, tc.diff)
+			}
+
+			if err := s.Push(cs); err != nil {
+				t.Fatal(err)
+			}
+
+			if msg := git(t, clone, "log", "-1", "--format=%B", "casper/update"); msg != tc.message {
+				t.Errorf("Got `%v`; want `%v`", msg, tc.message)
+			}
+
+			files := strings.Fields(git(t, clone, "ls-tree", "-r", "--name-only", "casper/update"))
+			if len(files) != len(tc.files) {
+				t.Errorf("Got files %v; want %v", files, tc.files)
+			}
+
+			for name, content := range tc.files {
+				if data := git(t, clone, "show", "casper/update:"+name); data != content {
+					t.Errorf("Got %v; want %v", data, content)
+				}
+			}
+
+			// the base branch is not changed
+			if msg := git(t, clone, "log", "-1", "--format=%s", base); msg != "Add files" {
+				t.Errorf("Got `%v`; want `Add files`", msg)
+			}
+		})
+	}
+}
+
+func TestCommitMessage(t *testing.T) {
+	clone, cleanup := prepareRepo(t)
+	defer cleanup()
+
+	testCases := []struct {
+		format  string
+		old     string
+		config  string
+		message string
+	}{
+		{"yaml", "", "key: val\n", "Update config\n\nadd key\n"},
+		{"yaml", "key: val\n", "key: val2\nsub:\n  key: val\n", "Update config\n\nupdate key\nadd sub/key\n"},
+		// not parsable content
+		{"json", "not json", `{"key":"val"}`, "Update config\n"},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			s, err := New(clone + "?path=config")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ioutil.WriteFile(filepath.Join(clone, "config"), []byte(tc.old), 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			cs, err := s.GetChanges([]byte(tc.config), tc.format, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if msg := commitMessage(s.path, cs.(*changes).keys); msg != tc.message {
+				t.Errorf("Got `%v`; want `%v`", msg, tc.message)
+			}
+		})
+	}
+}
+
+func push(t *testing.T, s *Storage, config string) {
+	cs, err := s.GetChanges([]byte(config), "json", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Push(cs); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// commitFiles writes the files in the clone and commits them.
+func commitFiles(t *testing.T, clone string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(clone, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git(t, clone, "add", "--all")
+	git(t, clone, "commit", "-m", "Add files")
+}
+
+// prepareRepo creates a bare repository with a single commit and a clone of
+// it in a temporary directory. It returns the path to the clone.
+func prepareRepo(t *testing.T) (string, func()) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "casper")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bare := filepath.Join(dir, "remote.git")
+	clone := filepath.Join(dir, "clone")
+
+	git(t, dir, "init", "--bare", bare)
+	git(t, dir, "clone", bare, clone)
+	git(t, clone, "config", "user.name", "casper")
+	git(t, clone, "config", "user.email", "casper@example.com")
+	git(t, clone, "commit", "--allow-empty", "-m", "Initial commit")
+	git(t, clone, "push", "origin", "HEAD")
+
+	return clone, func() { os.RemoveAll(dir) }
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,115 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Kinds of the objects the storage can manage.
+const (
+	ConfigMap = "configmap"
+	Secret    = "secret"
+)
+
+// object is a ConfigMap or a Secret.
+type object struct {
+	name string
+	data map[string]string
+	// orig is the ConfigMap or Secret as it was read, nil for new objects.
+	// Everything but the data is sent back unchanged on update.
+	orig runtime.Object
+}
+
+// client reads and writes the ConfigMaps or Secrets in one namespace.
+type client struct {
+	kube      kubernetes.Interface
+	namespace string
+	kind      string
+}
+
+// Get returns the object with the given name or nil if it doesn't exist.
+func (c *client) Get(name string) (*object, error) {
+	ctx := context.Background()
+
+	if c.kind == Secret {
+		s, err := c.kube.CoreV1().Secrets(c.namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		o := &object{name, map[string]string{}, s}
+		for k, v := range s.Data {
+			o.data[k] = string(v)
+		}
+		return o, nil
+	}
+
+	cm, err := c.kube.CoreV1().ConfigMaps(c.namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	o := &object{name, map[string]string{}, cm}
+	for k, v := range cm.Data {
+		o.data[k] = v
+	}
+	return o, nil
+}
+
+// Create creates new object.
+func (c *client) Create(o *object) error {
+	ctx := context.Background()
+	meta := metav1.ObjectMeta{Name: o.name, Namespace: c.namespace}
+
+	if c.kind == Secret {
+		s := &corev1.Secret{ObjectMeta: meta, Data: secretData(o.data)}
+		_, err := c.kube.CoreV1().Secrets(c.namespace).Create(ctx, s, metav1.CreateOptions{})
+		return err
+	}
+
+	cm := &corev1.ConfigMap{ObjectMeta: meta, Data: o.data}
+	_, err := c.kube.CoreV1().ConfigMaps(c.namespace).Create(ctx, cm, metav1.CreateOptions{})
+	return err
+}
+
+// Update replaces the data of the object. The rest of the object, e.g. the
+// labels and the type of a Secret, is kept as it was read. It fails if the
+// object is changed since it was read.
+func (c *client) Update(o *object) error {
+	ctx := context.Background()
+
+	switch orig := o.orig.(type) {
+	case *corev1.Secret:
+		s := orig.DeepCopy()
+		s.Data = secretData(o.data)
+		_, err := c.kube.CoreV1().Secrets(c.namespace).Update(ctx, s, metav1.UpdateOptions{})
+		return err
+	case *corev1.ConfigMap:
+		cm := orig.DeepCopy()
+		cm.Data = o.data
+		_, err := c.kube.CoreV1().ConfigMaps(c.namespace).Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	}
+
+	return fmt.Errorf("invalid object type: %T", o.orig)
+}
+
+func secretData(data map[string]string) map[string][]byte {
+	d := make(map[string][]byte, len(data))
+	for k, v := range data {
+		d[k] = []byte(v)
+	}
+	return d
+}
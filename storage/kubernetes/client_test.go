@@ -0,0 +1,108 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestClient(t *testing.T) {
+	meta := metav1.ObjectMeta{
+		Name:            "app",
+		Namespace:       "ns",
+		ResourceVersion: "1",
+		Labels:          map[string]string{"app": "web"},
+		Annotations:     map[string]string{"note": "keep"},
+		OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "web"}},
+	}
+
+	testCases := []struct {
+		kind string
+		obj  runtime.Object
+		want runtime.Object
+	}{
+		{
+			ConfigMap,
+			&corev1.ConfigMap{ObjectMeta: meta, Data: map[string]string{"key": "val"}, BinaryData: map[string][]byte{"bin": {0, 1}}},
+			&corev1.ConfigMap{ObjectMeta: meta, Data: map[string]string{"key": "new"}, BinaryData: map[string][]byte{"bin": {0, 1}}},
+		},
+		{
+			Secret,
+			&corev1.Secret{ObjectMeta: meta, Type: corev1.SecretTypeTLS, Data: map[string][]byte{"key": []byte("val")}},
+			&corev1.Secret{ObjectMeta: meta, Type: corev1.SecretTypeTLS, Data: map[string][]byte{"key": []byte("new")}},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			kube := fake.NewSimpleClientset(tc.obj)
+			c := &client{kube, "ns", tc.kind}
+
+			o, err := c.Get("app")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if o.name != "app" || !reflect.DeepEqual(o.data, map[string]string{"key": "val"}) {
+				t.Errorf("Got %v; want app with key=val", o)
+			}
+
+			missing, err := c.Get("missing")
+			if err != nil || missing != nil {
+				t.Errorf("Got %v, %v; want nil object", missing, err)
+			}
+
+			// the update keeps the labels, annotations, the binary data and
+			// the type of the Secret
+			o.data["key"] = "new"
+			if err := c.Update(o); err != nil {
+				t.Fatal(err)
+			}
+
+			var got runtime.Object
+			if tc.kind == Secret {
+				got, err = kube.CoreV1().Secrets("ns").Get(context.Background(), "app", metav1.GetOptions{})
+			} else {
+				got, err = kube.CoreV1().ConfigMaps("ns").Get(context.Background(), "app", metav1.GetOptions{})
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestClientCreate(t *testing.T) {
+	for i, kind := range []string{ConfigMap, Secret} {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			c := &client{fake.NewSimpleClientset(), "ns", kind}
+
+			if err := c.Create(&object{name: "app", data: map[string]string{"key": "val"}}); err != nil {
+				t.Fatal(err)
+			}
+
+			o, err := c.Get("app")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if o == nil || !reflect.DeepEqual(o.data, map[string]string{"key": "val"}) {
+				t.Errorf("Got %v; want app with key=val", o)
+			}
+
+			if err := c.Create(&object{name: "app", data: map[string]string{}}); err == nil {
+				t.Error("Create of existing object should fail")
+			}
+		})
+	}
+}
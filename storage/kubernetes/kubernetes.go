@@ -0,0 +1,291 @@
+package kubernetes
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/miracl/casper"
+	"github.com/miracl/casper/consul"
+	"github.com/miracl/casper/diff"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// DefaultIgnoreVal is the default value that need to be set for a key to be
+// ignored.
+const DefaultIgnoreVal = "_ignore"
+
+// Modes of storing the config in the object data.
+const (
+	// FileMode stores the whole config in a single data key.
+	FileMode = "file"
+	// KVMode flattens the config and stores each leaf in a separate data key.
+	KVMode = "kv"
+)
+
+// Defaults for the storage settings.
+const (
+	DefaultKey = "config"
+	DefaultSep = "."
+)
+
+const maskedVal = "******"
+
+// Storage is an implementation of the storage interface that stores in a
+// Kubernetes ConfigMap or Secret.
+type Storage struct {
+	client    *client
+	name      string
+	mode      string
+	key       string
+	sep       string
+	ignoreVal string
+	mask      bool
+	lists     consul.ListMode
+}
+
+// New returns new Kubernetes storage. The cluster and the credentials are
+// taken from the kubeconfig like for kubectl or from the service account of
+// the pod. The server and the token in the address override them.
+func New(addr string) (*Storage, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing Kubernetes address %v failed", addr)
+	}
+
+	q := u.Query()
+	name := q.Get("name")
+	if name == "" {
+		return nil, fmt.Errorf("missing object name in Kubernetes address %v", addr)
+	}
+
+	kind := valueOrDefault(q.Get("kind"), ConfigMap)
+	if kind != ConfigMap && kind != Secret {
+		return nil, fmt.Errorf("invalid Kubernetes object kind '%v'", kind)
+	}
+
+	mode := valueOrDefault(q.Get("mode"), FileMode)
+	if mode != FileMode && mode != KVMode {
+		return nil, fmt.Errorf("invalid Kubernetes storage mode '%v'", mode)
+	}
+
+	lists, err := consul.ParseListMode(q.Get("lists"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing Kubernetes address %v failed", addr)
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = q.Get("kubeconfig")
+
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: q.Get("context")}
+	overrides.AuthInfo.Token = q.Get("token")
+	if u.Host != "" {
+		overrides.ClusterInfo.Server = fmt.Sprintf("%v://%v", u.Scheme, u.Host)
+	}
+
+	cc := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+
+	// the namespace of the context or of the pod is used by default
+	namespace := q.Get("namespace")
+	if namespace == "" {
+		if namespace, _, err = cc.Namespace(); err != nil {
+			return nil, errors.Wrap(err, "reading Kubernetes namespace failed")
+		}
+	}
+
+	config, err := cc.ClientConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "loading Kubernetes config failed")
+	}
+
+	kube, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating Kubernetes client failed")
+	}
+
+	return &Storage{
+		client:    &client{kube, namespace, kind},
+		name:      name,
+		mode:      mode,
+		key:       valueOrDefault(q.Get("key"), DefaultKey),
+		sep:       valueOrDefault(q.Get("sep"), DefaultSep),
+		ignoreVal: valueOrDefault(q.Get("ignore"), DefaultIgnoreVal),
+		mask:      kind == Secret && q.Get("mask") != "false",
+		lists:     lists,
+	}, nil
+}
+
+func (s Storage) String(format string) (string, error) {
+	o, err := s.client.Get(s.name)
+	if err != nil {
+		return "", err
+	}
+
+	if o == nil {
+		o = &object{data: map[string]string{}}
+	}
+
+	if s.mode == FileMode {
+		return o.data[s.key], nil
+	}
+
+	return consul.KVPairsToString(s.pairs(o), format, s.lists), nil
+}
+
+// GetChanges returns changes between the config and the Storage content.
+func (s Storage) GetChanges(config []byte, format, key string) (casper.Changes, error) {
+	o, err := s.client.Get(s.name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting %v failed", s.name)
+	}
+
+	if o == nil {
+		o = &object{name: s.name, data: map[string]string{}}
+	}
+
+	if s.mode == FileMode {
+		// the keys are only used to explain the changes so the content
+		// that can't be parsed has no keys
+		keys, _ := consul.ConfigChanges([]byte(o.data[s.key]), config, format, s.lists)
+		return &changes{fileChanges(o.data, s.key, string(config)), o, s.maskChanges(keys)}, nil
+	}
+
+	kvChanges, err := consul.KVChanges(s.pairs(o), config, format, key, s.ignoreVal, s.lists)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range kvChanges {
+		if _, ok := c.(*diff.Remove); ok {
+			continue
+		}
+
+		// the key can't be told apart from the nested keys in the data
+		for _, part := range strings.Split(c.Key(), "/") {
+			if strings.Contains(part, s.sep) {
+				return nil, fmt.Errorf("key %v contains the separator %v", c.Key(), s.sep)
+			}
+		}
+	}
+
+	return &changes{kvChanges, o, s.maskChanges(kvChanges)}, nil
+}
+
+// Lists returns how the storage flattens the lists of the config.
+func (s Storage) Lists() consul.ListMode {
+	return s.lists
+}
+
+// Diff returns the visual representation of the changes. The values of a
+// Secret are masked unless the storage is created with mask=false.
+func (s Storage) Diff(cs casper.Changes, pretty bool) string {
+	return diff.Diff(s.maskChanges(cs.(*changes).KVChanges), pretty)
+}
+
+// maskChanges returns the changes with the values replaced by maskedVal if
+// the storage masks them.
+func (s Storage) maskChanges(kvChanges diff.KVChanges) diff.KVChanges {
+	if !s.mask {
+		return kvChanges
+	}
+
+	masked := diff.KVChanges{}
+	for _, c := range kvChanges {
+		switch c.(type) {
+		case *diff.Add:
+			masked = append(masked, diff.NewAdd(c.Key(), maskedVal))
+		case *diff.Update:
+			masked = append(masked, diff.NewUpdate(c.Key(), maskedVal, maskedVal))
+		case *diff.Remove:
+			masked = append(masked, diff.NewRemove(c.Key(), maskedVal))
+		}
+	}
+	return masked
+}
+
+// Push changes to the storage. The object is updated only if it is not
+// changed since GetChanges.
+func (s Storage) Push(cs casper.Changes) error {
+	c := cs.(*changes)
+	if c.Len() == 0 {
+		return nil
+	}
+
+	o := &object{name: s.name, data: map[string]string{}, orig: c.obj.orig}
+	for k, v := range c.obj.data {
+		o.data[k] = v
+	}
+
+	for _, ci := range c.KVChanges {
+		key := ci.Key()
+		if s.mode == KVMode {
+			key = s.dataKey(key)
+		}
+
+		switch v := ci.(type) {
+		case *diff.Add:
+			o.data[key] = v.Val()
+		case *diff.Update:
+			o.data[key] = v.NewVal()
+		case *diff.Remove:
+			delete(o.data, key)
+		default:
+			return fmt.Errorf("invalid change type: %T", ci)
+		}
+	}
+
+	if o.orig == nil {
+		return errors.Wrapf(s.client.Create(o), "creating %v failed", s.name)
+	}
+
+	return errors.Wrapf(s.client.Update(o), "updating %v failed", s.name)
+}
+
+// pairs returns the object data as flattened key/value pairs.
+func (s Storage) pairs(o *object) api.KVPairs {
+	pairs := api.KVPairs{}
+	for k, v := range o.data {
+		pairs = append(pairs, &api.KVPair{Key: strings.Replace(k, s.sep, "/", -1), Value: []byte(v)})
+	}
+
+	return pairs
+}
+
+// dataKey converts flattened key to valid object data key.
+func (s Storage) dataKey(key string) string {
+	return strings.Replace(key, "/", s.sep, -1)
+}
+
+func fileChanges(data map[string]string, key, config string) diff.KVChanges {
+	cur, ok := data[key]
+	switch {
+	case !ok:
+		return diff.KVChanges{diff.NewAdd(key, config)}
+	case cur != config:
+		return diff.KVChanges{diff.NewUpdate(key, cur, config)}
+	}
+
+	return diff.KVChanges{}
+}
+
+type changes struct {
+	diff.KVChanges
+	obj *object
+	// keys are the changes shown by KeyChanges, masked like in Diff
+	keys diff.KVChanges
+}
+
+// KeyChanges returns the changes of the keys in the config.
+func (c changes) KeyChanges() diff.KVChanges {
+	return c.keys
+}
+
+func valueOrDefault(val, def string) string {
+	if val == "" {
+		return def
+	}
+	return val
+}
@@ -0,0 +1,304 @@
+package kubernetes
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/miracl/casper"
+	"github.com/miracl/casper/consul"
+	"github.com/miracl/casper/diff"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// It is defined in each package so you can run `go test ./...`
+var full = flag.Bool("full", false, "Run all tests including integration")
+
+// newTestStorage returns the storage of the object app in the namespace ns
+// of a fake cluster with the objects.
+func newTestStorage(kind, mode string, objs ...runtime.Object) (*Storage, *fake.Clientset) {
+	kube := fake.NewSimpleClientset(objs...)
+	s := &Storage{&client{kube, "ns", kind}, "app", mode, DefaultKey, DefaultSep, DefaultIgnoreVal, kind == Secret, consul.IndexedLists}
+	return s, kube
+}
+
+func configMap(data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "ns"}, Data: data}
+}
+
+func configMapData(t *testing.T, kube *fake.Clientset) map[string]string {
+	cm, err := kube.CoreV1().ConfigMaps("ns").Get(context.Background(), "app", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cm.Data
+}
+
+func TestNewKubernetesStorage(t *testing.T) {
+	os.Setenv("KUBECONFIG", "testdata/kubeconfig")
+	defer os.Unsetenv("KUBECONFIG")
+
+	testCases := []struct {
+		addr      string
+		mode      string
+		key       string
+		host      string
+		namespace string
+		mask      bool
+		ok        bool
+	}{
+		{"kubernetes:///?name=app", FileMode, DefaultKey, "dev.example.com:6443", "dev-ns", false, true},
+		{"kubernetes:///?name=app&context=prod&kind=secret&mode=kv&namespace=other", KVMode, DefaultKey, "prod.example.com:6443", "other", true, true},
+		{"kubernetes:///?name=app&context=prod&kind=secret&mask=false", FileMode, DefaultKey, "prod.example.com:6443", "prod-ns", false, true},
+		{"http://127.0.0.1:8001/?name=app&key=app.yaml", FileMode, "app.yaml", "127.0.0.1:8001", "dev-ns", false, true},
+		{"http://127.0.0.1:8001/?name=app&mode=kv&lists=json", KVMode, DefaultKey, "127.0.0.1:8001", "dev-ns", false, true},
+		{"kubernetes:///?name=app&context=missing", "", "", "", "", false, false},
+		{"kubernetes:///?name=app&kubeconfig=testdata/missing", "", "", "", "", false, false},
+		{"http://127.0.0.1:8001/?name=app&mode=kv&lists=other", "", "", "", "", false, false},
+		{"http://127.0.0.1:8001/?name=app&kind=pod", "", "", "", "", false, false},
+		{"http://127.0.0.1:8001/?name=app&mode=invalid", "", "", "", "", false, false},
+		{"http://127.0.0.1:8001/", "", "", "", "", false, false},
+		{"", "", "", "", "", false, false},
+		{"http://192.168.0.%31/", "", "", "", "", false, false},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			s, err := New(tc.addr)
+			if tc.ok != (err == nil) {
+				if err != nil {
+					t.Fatal(err)
+				} else {
+					t.Fatal("Should fail")
+				}
+			}
+
+			if !tc.ok {
+				return
+			}
+
+			if s.mode != tc.mode || s.key != tc.key || s.mask != tc.mask {
+				t.Errorf("Got mode %v, key %v, mask %v; want %v, %v, %v", s.mode, s.key, s.mask, tc.mode, tc.key, tc.mask)
+			}
+
+			host := s.client.kube.CoreV1().RESTClient().Get().URL().Host
+			if host != tc.host || s.client.namespace != tc.namespace {
+				t.Errorf("Got host %v, namespace %v; want %v, %v", host, s.client.namespace, tc.host, tc.namespace)
+			}
+		})
+	}
+}
+
+func TestKubernetesStorageString(t *testing.T) {
+	testCases := []struct {
+		objs []runtime.Object
+		mode string
+		str  string
+	}{
+		{
+			[]runtime.Object{configMap(map[string]string{"config": "key1: val1\n"})},
+			FileMode,
+			"key1: val1\n",
+		},
+		{
+			[]runtime.Object{configMap(map[string]string{"key1": "val1", "key2.sub": "val2"})},
+			KVMode,
+			`{"key1":"val1","key2":{"sub":"val2"}}`,
+		},
+		{nil, FileMode, ""},
+		{nil, KVMode, "{}"},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			s, _ := newTestStorage(ConfigMap, tc.mode, tc.objs...)
+			str, err := s.String("jsonraw")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if str != tc.str {
+				t.Errorf("Got `%v`; want `%v`", str, tc.str)
+			}
+		})
+	}
+}
+
+func TestKubernetesStoragePush(t *testing.T) {
+	testCases := []struct {
+		objs   []runtime.Object
+		mode   string
+		config string
+		diff   string
+		data   map[string]string
+	}{
+		{
+			[]runtime.Object{configMap(map[string]string{"config": `{"key1":"val1"}`, "other": "val"})},
+			FileMode,
+			`{"key1":"val2"}`,
+			"-config={\"key1\":\"val1\"}\n+config={\"key1\":\"val2\"}\n",
+			map[string]string{"config": `{"key1":"val2"}`, "other": "val"},
+		},
+		{
+			nil,
+			FileMode,
+			`{"key1":"val1"}`,
+			"+config={\"key1\":\"val1\"}\n",
+			map[string]string{"config": `{"key1":"val1"}`},
+		},
+		{
+			[]runtime.Object{configMap(map[string]string{"key1": "val1", "key2": "val2", "db.host": "old"})},
+			KVMode,
+			`{"key1":"val1","db":{"_value":"db","host":"new","port":"5432"},"key3":"_ignore"}`,
+			"" +
+				"+db/=db\n" +
+				"-db/host=old\n" +
+				"+db/host=new\n" +
+				"+db/port=5432\n" +
+				"-key2=val2\n",
+			map[string]string{"key1": "val1", "db.": "db", "db.host": "new", "db.port": "5432"},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			s, kube := newTestStorage(ConfigMap, tc.mode, tc.objs...)
+
+			cs, err := s.GetChanges([]byte(tc.config), "json", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			diff := s.Diff(cs, false)
+			if diff != tc.diff {
+				t.Errorf("Got `%v`; want `%v`", diff, tc.diff)
+			}
+
+			if err := s.Push(cs); err != nil {
+				t.Fatal(err)
+			}
+
+			if data := configMapData(t, kube); !reflect.DeepEqual(data, tc.data) {
+				t.Errorf("Got %v; want %v", data, tc.data)
+			}
+
+			cs, err = s.GetChanges([]byte(tc.config), "json", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cs.Len() != 0 {
+				t.Errorf("Got changes after push: %v", s.Diff(cs, false))
+			}
+		})
+	}
+}
+
+func TestKubernetesStorageSecretMask(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "ns"},
+		Data:       map[string][]byte{"key1": []byte("old"), "key2": []byte("val2")},
+	}
+
+	testCases := []struct {
+		mask bool
+		diff string
+		keys string
+	}{
+		{true, "-key1=******\n+key1=******\n-key2=******\n+key3=******\n", "-key1=******\n+key1=******\n-key2=******\n+key3=******\n"},
+		{false, "-key1=old\n+key1=new\n-key2=val2\n+key3=val3\n", "-key1=old\n+key1=new\n-key2=val2\n+key3=val3\n"},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			s, kube := newTestStorage(Secret, KVMode, secret)
+			s.mask = tc.mask
+
+			cs, err := s.GetChanges([]byte(`{"key1":"new","key3":"val3"}`), "json", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := s.Diff(cs, false); diff != tc.diff {
+				t.Errorf("Got `%v`; want `%v`", diff, tc.diff)
+			}
+
+			if keys := diff.Diff(cs.(casper.KeyChanges).KeyChanges(), false); keys != tc.keys {
+				t.Errorf("Got `%v`; want `%v`", keys, tc.keys)
+			}
+
+			// the values are pushed unmasked
+			if err := s.Push(cs); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := kube.CoreV1().Secrets("ns").Get(context.Background(), "app", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := map[string][]byte{"key1": []byte("new"), "key3": []byte("val3")}; !reflect.DeepEqual(got.Data, want) {
+				t.Errorf("Got %v; want %v", got.Data, want)
+			}
+		})
+	}
+}
+
+func TestKubernetesStorageSeparatorInKey(t *testing.T) {
+	s, _ := newTestStorage(ConfigMap, KVMode, configMap(map[string]string{"log.level": "info"}))
+
+	// log.level in the data is the nested key log/level
+	cs, err := s.GetChanges([]byte(`{"log":{"level":"info"}}`), "json", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cs.Len() != 0 {
+		t.Errorf("Got changes %v; want none", s.Diff(cs, false))
+	}
+
+	_, err = s.GetChanges([]byte(`{"log.level":"debug"}`), "json", "")
+	if want := "key log.level contains the separator ."; err == nil || err.Error() != want {
+		t.Errorf("Got %v; want %v", err, want)
+	}
+}
+
+func TestKubernetesStoragePushConflict(t *testing.T) {
+	cm := configMap(map[string]string{"config": "old"})
+	cm.ResourceVersion = "1"
+	s, kube := newTestStorage(ConfigMap, FileMode, cm)
+
+	cs, err := s.GetChanges([]byte("new"), "yaml", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the fake clientset doesn't check the resource version so the API
+	// server rejecting the update of a concurrently changed object is
+	// simulated
+	var version string
+	kube.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		version = action.(k8stesting.UpdateAction).GetObject().(*corev1.ConfigMap).ResourceVersion
+		return true, nil, apierrors.NewConflict(corev1.Resource("configmaps"), "app", errors.New("the object has been modified"))
+	})
+
+	if err := s.Push(cs); err == nil || !apierrors.IsConflict(errors.Cause(err)) {
+		t.Fatalf("Got %v; want conflict", err)
+	}
+
+	if version != "1" {
+		t.Errorf("Got resource version %v; want 1", version)
+	}
+
+	if data := configMapData(t, kube); data["config"] != "old" {
+		t.Errorf("Got %v; want old", data["config"])
+	}
+}
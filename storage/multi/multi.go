@@ -0,0 +1,148 @@
+package multi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miracl/casper"
+	"github.com/pkg/errors"
+)
+
+// Member is a storage of the multi storage. The name is used to identify
+// the storage in the output.
+type Member struct {
+	Name    string
+	Storage casper.Storage
+}
+
+// Storage is an implementation of the storage interface that mirrors the
+// config to several storages.
+type Storage struct {
+	members []Member
+}
+
+// New returns new multi storage. The changes are pushed to the members in
+// the given order.
+func New(members ...Member) *Storage {
+	return &Storage{members}
+}
+
+// PushError is returned by Push if pushing to one of the members fails.
+type PushError struct {
+	// Pushed are the names of the members that were updated.
+	Pushed []string
+	// Failed is the name of the member that failed.
+	Failed string
+	// Skipped are the names of the members that were not tried.
+	Skipped []string
+	Err     error
+}
+
+func (e *PushError) Error() string {
+	msg := fmt.Sprintf("pushing to %v failed: %v", e.Failed, e.Err)
+	if len(e.Pushed) > 0 {
+		msg += fmt.Sprintf("; pushed to: %v", strings.Join(e.Pushed, ", "))
+	}
+	if len(e.Skipped) > 0 {
+		msg += fmt.Sprintf("; not pushed to: %v", strings.Join(e.Skipped, ", "))
+	}
+	return msg
+}
+
+// String returns the content of every member in a separate section.
+func (s Storage) String(format string) (string, error) {
+	sections := make([]string, len(s.members))
+	for i, m := range s.members {
+		str, err := m.Storage.String(format)
+		if err != nil {
+			return "", errors.Wrapf(err, "getting content of %v failed", m.Name)
+		}
+		sections[i] = section(m.Name, str)
+	}
+
+	return strings.Join(sections, "\n"), nil
+}
+
+// GetChanges returns changes between the config and the content of every
+// member.
+func (s Storage) GetChanges(config []byte, format, key string) (casper.Changes, error) {
+	cs := changes{}
+	for _, m := range s.members {
+		c, err := m.Storage.GetChanges(config, format, key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "getting changes for %v failed", m.Name)
+		}
+		cs = append(cs, c)
+	}
+
+	return cs, nil
+}
+
+// Diff returns the visual representation of the changes of every member in
+// a separate section.
+func (s Storage) Diff(cs casper.Changes, pretty bool) string {
+	return s.DiffWith(cs, func(m casper.Storage, c casper.Changes) string {
+		return m.Diff(c, pretty)
+	})
+}
+
+// DiffWith is like Diff but the changes of every member are shown with
+// diff.
+func (s Storage) DiffWith(cs casper.Changes, diff func(casper.Storage, casper.Changes) string) string {
+	c := cs.(changes)
+
+	sections := make([]string, len(s.members))
+	for i, m := range s.members {
+		str := "No changes"
+		if c[i].Len() != 0 {
+			str = strings.TrimRight(diff(m.Storage, c[i]), "\n")
+		}
+		sections[i] = section(m.Name, str)
+	}
+
+	return strings.Join(sections, "\n")
+}
+
+// Push changes to the members in order. Members without changes are
+// skipped. If a member fails the rest are not pushed and *PushError is
+// returned.
+func (s Storage) Push(cs casper.Changes) error {
+	c := cs.(changes)
+
+	pushed := []string{}
+	for i, m := range s.members {
+		if c[i].Len() == 0 {
+			continue
+		}
+
+		if err := m.Storage.Push(c[i]); err != nil {
+			skipped := []string{}
+			for j := i + 1; j < len(s.members); j++ {
+				if c[j].Len() != 0 {
+					skipped = append(skipped, s.members[j].Name)
+				}
+			}
+
+			return &PushError{pushed, m.Name, skipped, err}
+		}
+
+		pushed = append(pushed, m.Name)
+	}
+
+	return nil
+}
+
+func section(name, content string) string {
+	return fmt.Sprintf("==> %v <==\n%v\n", name, content)
+}
+
+// changes are the changes of the members in the same order.
+type changes []casper.Changes
+
+func (cs changes) Len() int {
+	l := 0
+	for _, c := range cs {
+		l += c.Len()
+	}
+	return l
+}
@@ -0,0 +1,185 @@
+package multi
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/miracl/casper"
+)
+
+// It is defined in each package so you can run `go test ./...`
+var full = flag.Bool("full", false, "Run all tests including integration")
+
+type storageMock struct {
+	content string
+	pushErr error
+	pushed  bool
+}
+
+type changesMock struct {
+	old, new string
+}
+
+func (c changesMock) Len() int {
+	if c.old == c.new {
+		return 0
+	}
+	return 1
+}
+
+func (s *storageMock) String(format string) (string, error) {
+	return s.content, nil
+}
+
+func (s *storageMock) GetChanges(config []byte, format, key string) (casper.Changes, error) {
+	if s.content == "error" {
+		return nil, errors.New("error")
+	}
+	return changesMock{s.content, string(config)}, nil
+}
+
+func (s *storageMock) Diff(cs casper.Changes, pretty bool) string {
+	c := cs.(changesMock)
+	return fmt.Sprintf("-%v\n+%v\n", c.old, c.new)
+}
+
+func (s *storageMock) Push(cs casper.Changes) error {
+	if s.pushErr != nil {
+		return s.pushErr
+	}
+	s.content = cs.(changesMock).new
+	s.pushed = true
+	return nil
+}
+
+func TestMultiStorageString(t *testing.T) {
+	s := New(Member{"first", &storageMock{content: "a"}}, Member{"second", &storageMock{content: "b"}})
+
+	str, err := s.String("yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := "==> first <==\na\n\n==> second <==\nb\n"
+	if str != exp {
+		t.Errorf("Got `%v`; want `%v`", str, exp)
+	}
+}
+
+func TestMultiStorageDiff(t *testing.T) {
+	testCases := []struct {
+		members []Member
+		len     int
+		diff    string
+		ok      bool
+	}{
+		{
+			[]Member{{"first", &storageMock{content: "old"}}, {"second", &storageMock{content: "new"}}},
+			1,
+			"==> first <==\n-old\n+new\n\n==> second <==\nNo changes\n",
+			true,
+		},
+		{
+			[]Member{{"first", &storageMock{content: "new"}}, {"second", &storageMock{content: "new"}}},
+			0,
+			"==> first <==\nNo changes\n\n==> second <==\nNo changes\n",
+			true,
+		},
+		{
+			[]Member{{"first", &storageMock{content: "old"}}, {"second", &storageMock{content: "error"}}},
+			0,
+			"",
+			false,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			s := New(tc.members...)
+
+			cs, err := s.GetChanges([]byte("new"), "yaml", "")
+			if tc.ok != (err == nil) {
+				if err != nil {
+					t.Fatal(err)
+				} else {
+					t.Fatal("Should fail")
+				}
+			}
+
+			if !tc.ok {
+				return
+			}
+
+			if cs.Len() != tc.len {
+				t.Errorf("Got %v; want %v", cs.Len(), tc.len)
+			}
+
+			if diff := s.Diff(cs, false); diff != tc.diff {
+				t.Errorf("Got `%v`; want `%v`", diff, tc.diff)
+			}
+		})
+	}
+}
+
+func TestMultiStoragePush(t *testing.T) {
+	errPush := errors.New("push failed")
+
+	testCases := []struct {
+		members []*storageMock
+		pushed  []bool
+		err     *PushError
+	}{
+		{
+			[]*storageMock{{content: "old"}, {content: "new"}, {content: "old"}},
+			[]bool{true, false, true},
+			nil,
+		},
+		{
+			[]*storageMock{{content: "old"}, {content: "new"}, {content: "old", pushErr: errPush}, {content: "new"}, {content: "old"}},
+			[]bool{true, false, false, false, false},
+			&PushError{[]string{"m0"}, "m2", []string{"m4"}, errPush},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			members := make([]Member, len(tc.members))
+			for i, m := range tc.members {
+				members[i] = Member{fmt.Sprintf("m%v", i), m}
+			}
+			s := New(members...)
+
+			cs, err := s.GetChanges([]byte("new"), "yaml", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = s.Push(cs)
+			if tc.err == nil && err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.err != nil && !reflect.DeepEqual(err, tc.err) {
+				t.Errorf("Got %#v; want %#v", err, tc.err)
+			}
+
+			for i, m := range tc.members {
+				if m.pushed != tc.pushed[i] {
+					t.Errorf("Got %v for m%v; want %v", m.pushed, i, tc.pushed[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPushError(t *testing.T) {
+	err := &PushError{[]string{"a", "b"}, "c", []string{"d"}, errors.New("error")}
+
+	exp := "pushing to c failed: error; pushed to: a, b; not pushed to: d"
+	if err.Error() != exp {
+		t.Errorf("Got `%v`; want `%v`", err.Error(), exp)
+	}
+}
@@ -0,0 +1,136 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// redisError is an error reply from Redis.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// client is a minimal Redis client speaking RESP over a single connection.
+// The connection is opened on first use.
+type client struct {
+	addr     string
+	password string
+	db       string
+
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newClient(addr, password, db string) *client {
+	return &client{addr: addr, password: password, db: db}
+}
+
+// Do sends a command and returns the reply. Status and bulk string replies
+// are returned as string, integers as int64, arrays as []interface{} and
+// null replies as nil.
+func (c *client) Do(args ...string) (interface{}, error) {
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.do(args...)
+}
+
+func (c *client) connect() error {
+	conn, err := net.DialTimeout("tcp", c.addr, 10*time.Second)
+	if err != nil {
+		return errors.Wrapf(err, "connecting to Redis %v failed", c.addr)
+	}
+	c.conn = conn
+	c.r = bufio.NewReader(conn)
+
+	if c.password != "" {
+		if _, err := c.do("AUTH", c.password); err != nil {
+			return errors.Wrap(err, "Redis authentication failed")
+		}
+	}
+
+	if c.db != "" && c.db != "0" {
+		if _, err := c.do("SELECT", c.db); err != nil {
+			return errors.Wrapf(err, "selecting Redis database %v failed", c.db)
+		}
+	}
+
+	return nil
+}
+
+func (c *client) do(args ...string) (interface{}, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, errors.Wrap(err, "writing to Redis failed")
+	}
+
+	return readReply(c.r)
+}
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, errors.Wrap(err, "reading from Redis failed")
+	}
+
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, errors.Wrap(err, "reading from Redis failed")
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+
+		arr := make([]interface{}, n)
+		for i := range arr {
+			// errors inside arrays (e.g. from EXEC) are kept as values
+			arr[i], err = readReply(r)
+			if e, ok := err.(redisError); ok {
+				arr[i] = e
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	}
+
+	return nil, fmt.Errorf("redis: invalid reply %q", line)
+}
@@ -0,0 +1,313 @@
+package redis
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/miracl/casper"
+	"github.com/miracl/casper/consul"
+	"github.com/miracl/casper/diff"
+	"github.com/pkg/errors"
+)
+
+// DefaultIgnoreVal is the default value that need to be set for a key to be
+// ignored.
+const DefaultIgnoreVal = "_ignore"
+
+// ErrConflict is returned by Push if the storage is changed after the
+// changes were calculated.
+var ErrConflict = errors.New("redis: keys changed since the diff, try again")
+
+// conn is interface that the Redis client implements.
+// Defined and used mainly for testing.
+type conn interface {
+	Do(args ...string) (interface{}, error)
+}
+
+// Storage is an implementation of the storage interface that stores in
+// Redis. The flattened keys are stored either as separate string keys under
+// a prefix or as fields of a single hash.
+type Storage struct {
+	conn      conn
+	prefix    string
+	hash      string
+	ignoreVal string
+	lists     consul.ListMode
+}
+
+// New returns new Redis storage.
+func New(addr string) (*Storage, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing Redis address %v failed", addr)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid Redis address %v", addr)
+	}
+
+	password := ""
+	if u.User != nil {
+		password, _ = u.User.Password()
+	}
+
+	ignore := u.Query().Get("ignore")
+	if ignore == "" {
+		ignore = DefaultIgnoreVal
+	}
+
+	lists, err := consul.ParseListMode(u.Query().Get("lists"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing Redis address %v failed", addr)
+	}
+
+	c := newClient(u.Host, password, strings.Trim(u.Path, "/"))
+	return &Storage{c, u.Query().Get("prefix"), u.Query().Get("hash"), ignore, lists}, nil
+}
+
+func (s Storage) String(format string) (string, error) {
+	pairs, err := s.pairs()
+	if err != nil {
+		return "", err
+	}
+
+	return consul.KVPairsToString(pairs, format, s.lists), nil
+}
+
+// GetChanges returns changes between the config and the Storage content.
+func (s Storage) GetChanges(config []byte, format, key string) (casper.Changes, error) {
+	pairs, err := s.pairs()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting keys from Redis failed")
+	}
+
+	return consul.KVChanges(pairs, config, format, key, s.ignoreVal, s.lists)
+}
+
+// Lists returns how the storage flattens the lists of the config.
+func (s Storage) Lists() consul.ListMode {
+	return s.lists
+}
+
+// Diff returns the visual representation of the changes.
+func (Storage) Diff(cs casper.Changes, pretty bool) string {
+	return diff.Diff(cs.(diff.KVChanges), pretty)
+}
+
+// Push changes to the storage. The changes are applied in a MULTI/EXEC
+// transaction that is aborted with ErrConflict if any of the changed keys is
+// modified after GetChanges.
+func (s Storage) Push(cs casper.Changes) error {
+	changes := cs.(diff.KVChanges)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	keys := make([]string, len(changes))
+	for i, c := range changes {
+		keys[i] = c.Key()
+	}
+
+	watch := []string{"WATCH", s.hash}
+	if s.hash == "" {
+		watch = append([]string{"WATCH"}, s.redisKeys(keys)...)
+	}
+	if _, err := s.conn.Do(watch...); err != nil {
+		return err
+	}
+
+	// make sure nothing changed between GetChanges and WATCH
+	cur, err := s.values(keys)
+	if err != nil {
+		s.conn.Do("UNWATCH")
+		return err
+	}
+
+	for i, ci := range changes {
+		_, isAdd := ci.(*diff.Add)
+		if (isAdd && cur[i] != nil) || (!isAdd && (cur[i] == nil || *cur[i] != ci.Val())) {
+			s.conn.Do("UNWATCH")
+			return ErrConflict
+		}
+	}
+
+	if _, err := s.conn.Do("MULTI"); err != nil {
+		return err
+	}
+
+	for _, ci := range changes {
+		if _, err := s.conn.Do(s.command(ci)...); err != nil {
+			s.conn.Do("DISCARD")
+			return err
+		}
+	}
+
+	res, err := s.conn.Do("EXEC")
+	if err != nil {
+		return err
+	}
+
+	if res == nil {
+		return ErrConflict
+	}
+
+	for _, r := range res.([]interface{}) {
+		if err, ok := r.(error); ok {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// command returns the Redis command for the change.
+func (s Storage) command(change diff.KVChange) []string {
+	var val string
+	switch c := change.(type) {
+	case *diff.Add:
+		val = c.Val()
+	case *diff.Update:
+		val = c.NewVal()
+	case *diff.Remove:
+		if s.hash != "" {
+			return []string{"HDEL", s.hash, c.Key()}
+		}
+		return []string{"DEL", s.prefix + c.Key()}
+	}
+
+	if s.hash != "" {
+		return []string{"HSET", s.hash, change.Key(), val}
+	}
+	return []string{"SET", s.prefix + change.Key(), val}
+}
+
+// pairs returns the current content of the storage.
+func (s Storage) pairs() (api.KVPairs, error) {
+	pairs := api.KVPairs{}
+
+	if s.hash != "" {
+		res, err := s.conn.Do("HGETALL", s.hash)
+		if err != nil {
+			return nil, err
+		}
+
+		arr, _ := res.([]interface{})
+		for i := 0; i+1 < len(arr); i += 2 {
+			pairs = append(pairs, &api.KVPair{Key: toString(arr[i]), Value: []byte(toString(arr[i+1]))})
+		}
+
+		return pairs, nil
+	}
+
+	keys, err := s.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	vals, err := s.values(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, k := range keys {
+		// skip keys deleted in the meantime
+		if vals[i] != nil {
+			pairs = append(pairs, &api.KVPair{Key: k, Value: []byte(*vals[i])})
+		}
+	}
+
+	return pairs, nil
+}
+
+// scan returns all keys under the prefix with the prefix trimmed.
+func (s Storage) scan() ([]string, error) {
+	keys := []string{}
+	seen := map[string]bool{}
+	cursor := "0"
+	for {
+		res, err := s.conn.Do("SCAN", cursor, "MATCH", escapePattern(s.prefix)+"*", "COUNT", "1000")
+		if err != nil {
+			return nil, err
+		}
+
+		arr, ok := res.([]interface{})
+		if !ok || len(arr) != 2 {
+			return nil, fmt.Errorf("redis: invalid SCAN reply %v", res)
+		}
+
+		page, _ := arr[1].([]interface{})
+		for _, k := range page {
+			key := strings.TrimPrefix(toString(k), s.prefix)
+			// SCAN can return the same key more than once
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+
+		cursor = toString(arr[0])
+		if cursor == "0" {
+			return keys, nil
+		}
+	}
+}
+
+// values returns the values of the keys. Missing keys have nil value.
+func (s Storage) values(keys []string) ([]*string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	var cmd []string
+	if s.hash != "" {
+		cmd = append([]string{"HMGET", s.hash}, keys...)
+	} else {
+		cmd = append([]string{"MGET"}, s.redisKeys(keys)...)
+	}
+
+	res, err := s.conn.Do(cmd...)
+	if err != nil {
+		return nil, err
+	}
+
+	arr, _ := res.([]interface{})
+	if len(arr) != len(keys) {
+		return nil, fmt.Errorf("redis: invalid %v reply %v", cmd[0], res)
+	}
+
+	vals := make([]*string, len(keys))
+	for i, v := range arr {
+		if v != nil {
+			str := toString(v)
+			vals[i] = &str
+		}
+	}
+
+	return vals, nil
+}
+
+func (s Storage) redisKeys(keys []string) []string {
+	redisKeys := make([]string, len(keys))
+	for i, k := range keys {
+		redisKeys[i] = s.prefix + k
+	}
+	return redisKeys
+}
+
+func toString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case int64:
+		return fmt.Sprint(val)
+	}
+	return ""
+}
+
+// escapePattern escapes the glob special characters in the prefix.
+func escapePattern(p string) string {
+	r := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+	return r.Replace(p)
+}
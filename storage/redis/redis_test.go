@@ -0,0 +1,258 @@
+package redis
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// It is defined in each package so you can run `go test ./...`
+var full = flag.Bool("full", false, "Run all tests including integration")
+
+func TestNewRedisStorage(t *testing.T) {
+	testCases := []struct {
+		addr   string
+		prefix string
+		hash   string
+		ok     bool
+	}{
+		{"redis://127.0.0.1:6379", "", "", true},
+		{"redis://:pass@127.0.0.1:6379/2?prefix=app:", "app:", "", true},
+		{"redis://127.0.0.1:6379/?hash=app:flags&ignore=skip", "", "app:flags", true},
+		{"redis://127.0.0.1:6379/?lists=join", "", "", true},
+		{"redis://127.0.0.1:6379/?lists=other", "", "", false},
+		{"", "", "", false},
+		{"redis://192.168.0.%31/", "", "", false},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			s, err := New(tc.addr)
+			if tc.ok != (err == nil) {
+				if err != nil {
+					t.Fatal(err)
+				} else {
+					t.Fatal("Should fail")
+				}
+			}
+
+			if !tc.ok {
+				return
+			}
+
+			if s.prefix != tc.prefix || s.hash != tc.hash {
+				t.Errorf("Got prefix %v, hash %v; want %v, %v", s.prefix, s.hash, tc.prefix, tc.hash)
+			}
+		})
+	}
+}
+
+func TestRedisStorageString(t *testing.T) {
+	srv := newServer(t, "pass")
+	defer srv.Close()
+
+	srv.set("app:key1", "val1")
+	srv.set("app:key2/sub", "val2")
+	srv.set("other", "val")
+	srv.hset("flags", "flag1", "on")
+
+	testCases := []struct {
+		addr string
+		str  string
+		ok   bool
+	}{
+		{"redis://:pass@%v/?prefix=app:", `{"key1":"val1","key2":{"sub":"val2"}}`, true},
+		{"redis://:pass@%v/?hash=flags", `{"flag1":"on"}`, true},
+		{"redis://:pass@%v/?hash=missing", `{}`, true},
+		{"redis://:wrong@%v/?prefix=app:", "", false},
+		{"redis://%v/?prefix=app:", "", false},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			s, err := New(fmt.Sprintf(tc.addr, srv.Addr()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			str, err := s.String("jsonraw")
+			if tc.ok != (err == nil) {
+				if err != nil {
+					t.Fatal(err)
+				} else {
+					t.Fatal("Should fail")
+				}
+			}
+
+			if str != tc.str {
+				t.Errorf("Got `%v`; want `%v`", str, tc.str)
+			}
+		})
+	}
+}
+
+func TestRedisStoragePush(t *testing.T) {
+	testCases := []struct {
+		addr    string
+		strings map[string]string
+		hash    map[string]string
+		config  string
+		diff    string
+		expStr  map[string]string
+		expHash map[string]string
+	}{
+		{
+			"redis://%v/?prefix=app:",
+			map[string]string{"app:key1": "val1", "app:key2": "val2", "app:key3": "val", "other": "val"},
+			nil,
+			`{"key1":"val1","key3":"val3","key4":{"sub":"val4"},"key5":"_ignore"}`,
+			"" +
+				"-key2=val2\n" +
+				"-key3=val\n" +
+				"+key3=val3\n" +
+				"+key4/sub=val4\n",
+			map[string]string{"app:key1": "val1", "app:key3": "val3", "app:key4/sub": "val4", "other": "val"},
+			nil,
+		},
+		{
+			"redis://%v/?hash=flags",
+			nil,
+			map[string]string{"flag1": "on", "flag2": "off"},
+			`{"flag1":"off","flag3":true}`,
+			"" +
+				"-flag1=on\n" +
+				"+flag1=off\n" +
+				"-flag2=off\n" +
+				"+flag3=true\n",
+			nil,
+			map[string]string{"flag1": "off", "flag3": "true"},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			srv := newServer(t, "")
+			defer srv.Close()
+
+			for k, v := range tc.strings {
+				srv.set(k, v)
+			}
+			for k, v := range tc.hash {
+				srv.hset("flags", k, v)
+			}
+
+			s, err := New(fmt.Sprintf(tc.addr, srv.Addr()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cs, err := s.GetChanges([]byte(tc.config), "json", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			diff := s.Diff(cs, false)
+			if diff != tc.diff {
+				t.Errorf("Got `%v`; want `%v`", diff, tc.diff)
+			}
+
+			if err := s.Push(cs); err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.expStr != nil && !reflect.DeepEqual(srv.strings, tc.expStr) {
+				t.Errorf("Got %v; want %v", srv.strings, tc.expStr)
+			}
+
+			if tc.expHash != nil && !reflect.DeepEqual(srv.hashes["flags"], tc.expHash) {
+				t.Errorf("Got %v; want %v", srv.hashes["flags"], tc.expHash)
+			}
+
+			cs, err = s.GetChanges([]byte(tc.config), "json", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cs.Len() != 0 {
+				t.Errorf("Got changes after push: %v", s.Diff(cs, false))
+			}
+		})
+	}
+}
+
+func TestRedisStoragePushConflict(t *testing.T) {
+	testCases := []struct {
+		addr   string
+		modify func(srv *server)
+	}{
+		{"redis://%v/?prefix=app:", func(srv *server) { srv.set("app:key1", "other") }},
+		{"redis://%v/?prefix=app:", func(srv *server) { srv.set("app:key2", "other") }},
+		{"redis://%v/?hash=flags", func(srv *server) { srv.hset("flags", "key1", "other") }},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			srv := newServer(t, "")
+			defer srv.Close()
+
+			srv.set("app:key1", "val1")
+			srv.hset("flags", "key1", "val1")
+
+			s, err := New(fmt.Sprintf(tc.addr, srv.Addr()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cs, err := s.GetChanges([]byte(`{"key1":"val2","key2":"val2"}`), "json", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tc.modify(srv)
+
+			if err := s.Push(cs); err != ErrConflict {
+				t.Fatalf("Got %v; want %v", err, ErrConflict)
+			}
+		})
+	}
+}
+
+// conflictingConn modifies the storage between WATCH and EXEC.
+type conflictingConn struct {
+	conn
+	srv *server
+}
+
+func (c conflictingConn) Do(args ...string) (interface{}, error) {
+	if args[0] == "EXEC" {
+		c.srv.set("app:key1", "other")
+	}
+	return c.conn.Do(args...)
+}
+
+func TestRedisStoragePushWatch(t *testing.T) {
+	srv := newServer(t, "")
+	defer srv.Close()
+
+	srv.set("app:key1", "val1")
+
+	s, err := New(fmt.Sprintf("redis://%v/?prefix=app:", srv.Addr()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.conn = conflictingConn{s.conn, srv}
+
+	cs, err := s.GetChanges([]byte(`{"key1":"val2"}`), "json", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Push(cs); err != ErrConflict {
+		t.Fatalf("Got %v; want %v", err, ErrConflict)
+	}
+
+	if srv.strings["app:key1"] != "other" {
+		t.Errorf("Got %v; want other", srv.strings["app:key1"])
+	}
+}
@@ -0,0 +1,273 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// server is an in-process Redis stand-in that supports the commands used by
+// the storage.
+type server struct {
+	l        net.Listener
+	password string
+
+	mu       sync.Mutex
+	strings  map[string]string
+	hashes   map[string]map[string]string
+	versions map[string]int
+}
+
+func newServer(t *testing.T, password string) *server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &server{
+		l:        l,
+		password: password,
+		strings:  map[string]string{},
+		hashes:   map[string]map[string]string{},
+		versions: map[string]int{},
+	}
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+
+	return s
+}
+
+func (s *server) Addr() string {
+	return s.l.Addr().String()
+}
+
+func (s *server) Close() {
+	s.l.Close()
+}
+
+// set modifies a string key as another client would.
+func (s *server) set(key, val string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.strings[key] = val
+	s.versions[key]++
+}
+
+// hset modifies a hash field as another client would.
+func (s *server) hset(hash, field, val string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hashes[hash] == nil {
+		s.hashes[hash] = map[string]string{}
+	}
+	s.hashes[hash][field] = val
+	s.versions[hash]++
+}
+
+type session struct {
+	authed  bool
+	watched map[string]int
+	queue   [][]string
+	multi   bool
+}
+
+func (s *server) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	sess := &session{authed: s.password == ""}
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		io.WriteString(c, s.handle(sess, args))
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	res, err := readReply(r)
+	if err != nil {
+		return nil, err
+	}
+
+	arr, ok := res.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid command %v", res)
+	}
+
+	args := make([]string, len(arr))
+	for i, a := range arr {
+		args[i] = a.(string)
+	}
+	return args, nil
+}
+
+func (s *server) handle(sess *session, args []string) string {
+	cmd := strings.ToUpper(args[0])
+
+	if cmd == "AUTH" {
+		if args[1] != s.password {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		sess.authed = true
+		return "+OK\r\n"
+	}
+
+	if !sess.authed {
+		return "-NOAUTH Authentication required.\r\n"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch cmd {
+	case "WATCH":
+		if sess.watched == nil {
+			sess.watched = map[string]int{}
+		}
+		for _, k := range args[1:] {
+			sess.watched[k] = s.versions[k]
+		}
+		return "+OK\r\n"
+	case "UNWATCH":
+		sess.watched = nil
+		return "+OK\r\n"
+	case "MULTI":
+		sess.multi = true
+		sess.queue = nil
+		return "+OK\r\n"
+	case "DISCARD":
+		sess.multi = false
+		sess.watched = nil
+		return "+OK\r\n"
+	case "EXEC":
+		sess.multi = false
+		watched := sess.watched
+		sess.watched = nil
+		for k, v := range watched {
+			if s.versions[k] != v {
+				return "*-1\r\n"
+			}
+		}
+
+		res := fmt.Sprintf("*%d\r\n", len(sess.queue))
+		for _, q := range sess.queue {
+			res += s.exec(q)
+		}
+		return res
+	}
+
+	if sess.multi {
+		sess.queue = append(sess.queue, args)
+		return "+QUEUED\r\n"
+	}
+
+	return s.exec(args)
+}
+
+func (s *server) exec(args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		v, ok := s.strings[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulk(v)
+	case "MGET":
+		res := fmt.Sprintf("*%d\r\n", len(args)-1)
+		for _, k := range args[1:] {
+			if v, ok := s.strings[k]; ok {
+				res += bulk(v)
+			} else {
+				res += "$-1\r\n"
+			}
+		}
+		return res
+	case "SET":
+		s.strings[args[1]] = args[2]
+		s.versions[args[1]]++
+		return "+OK\r\n"
+	case "DEL":
+		n := 0
+		for _, k := range args[1:] {
+			if _, ok := s.strings[k]; ok {
+				delete(s.strings, k)
+				s.versions[k]++
+				n++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	case "SCAN":
+		// return all keys in two pages to exercise the cursor
+		keys := []string{}
+		for k := range s.strings {
+			if strings.HasPrefix(k, strings.TrimSuffix(args[3], "*")) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		half := len(keys) / 2
+		next, page := "1", keys[:half]
+		if args[1] != "0" {
+			next, page = "0", keys[half:]
+		}
+		res := "*2\r\n" + bulk(next) + fmt.Sprintf("*%d\r\n", len(page))
+		for _, k := range page {
+			res += bulk(k)
+		}
+		return res
+	case "HGETALL":
+		h := s.hashes[args[1]]
+		res := fmt.Sprintf("*%d\r\n", 2*len(h))
+		for k, v := range h {
+			res += bulk(k) + bulk(v)
+		}
+		return res
+	case "HMGET":
+		h := s.hashes[args[1]]
+		res := fmt.Sprintf("*%d\r\n", len(args)-2)
+		for _, k := range args[2:] {
+			if v, ok := h[k]; ok {
+				res += bulk(v)
+			} else {
+				res += "$-1\r\n"
+			}
+		}
+		return res
+	case "HSET":
+		if s.hashes[args[1]] == nil {
+			s.hashes[args[1]] = map[string]string{}
+		}
+		s.hashes[args[1]][args[2]] = args[3]
+		s.versions[args[1]]++
+		return ":1\r\n"
+	case "HDEL":
+		delete(s.hashes[args[1]], args[2])
+		s.versions[args[1]]++
+		return ":1\r\n"
+	}
+
+	return "-ERR unknown command '" + args[0] + "'\r\n"
+}
+
+func bulk(s string) string {
+	return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n"
+}
@@ -0,0 +1,177 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// client is a minimal client for the Vault KV version 2 secrets engine.
+type client struct {
+	addr  string
+	token string
+	mount string
+	http  *http.Client
+}
+
+func newClient(addr, token, mount string) *client {
+	return &client{addr: addr, token: token, mount: mount, http: http.DefaultClient}
+}
+
+// secret is a single version of a KV v2 secret.
+type secret struct {
+	data    map[string]string
+	version int
+}
+
+type listResponse struct {
+	Data struct {
+		Keys []string `json:"keys"`
+	} `json:"data"`
+}
+
+type readResponse struct {
+	Data struct {
+		Data     map[string]interface{} `json:"data"`
+		Metadata struct {
+			Version int `json:"version"`
+		} `json:"metadata"`
+	} `json:"data"`
+}
+
+type metadataResponse struct {
+	Data struct {
+		CurrentVersion int `json:"current_version"`
+	} `json:"data"`
+}
+
+type writeRequest struct {
+	Options struct {
+		CAS int `json:"cas"`
+	} `json:"options"`
+	Data map[string]string `json:"data"`
+}
+
+type errorResponse struct {
+	Errors []string `json:"errors"`
+}
+
+// List returns the keys directly under path. Folders end with "/".
+func (c *client) List(path string) ([]string, error) {
+	res := listResponse{}
+	found, err := c.do("LIST", "metadata", path, nil, &res)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	return res.Data.Keys, nil
+}
+
+// Read returns the latest version of the secret at path. Deleted secrets
+// have no data but still have a version. Nil is returned if the secret never
+// existed.
+func (c *client) Read(path string) (*secret, error) {
+	res := readResponse{}
+	if _, err := c.do(http.MethodGet, "data", path, nil, &res); err != nil {
+		return nil, err
+	}
+
+	if res.Data.Metadata.Version == 0 {
+		return nil, nil
+	}
+
+	data := map[string]string{}
+	for k, v := range res.Data.Data {
+		switch val := v.(type) {
+		case string:
+			data[k] = val
+		default:
+			b, _ := json.Marshal(val)
+			data[k] = string(b)
+		}
+	}
+
+	return &secret{data, res.Data.Metadata.Version}, nil
+}
+
+// Version returns the current version of the secret at path from its
+// metadata. Zero is returned if the secret never existed.
+func (c *client) Version(path string) (int, error) {
+	res := metadataResponse{}
+	if _, err := c.do(http.MethodGet, "metadata", path, nil, &res); err != nil {
+		return 0, err
+	}
+
+	return res.Data.CurrentVersion, nil
+}
+
+// Write creates new version of the secret at path if its current version is
+// cas.
+func (c *client) Write(path string, data map[string]string, cas int) error {
+	req := writeRequest{Data: data}
+	req.Options.CAS = cas
+	_, err := c.do(http.MethodPost, "data", path, req, nil)
+	return err
+}
+
+// Delete deletes the latest version of the secret at path.
+func (c *client) Delete(path string) error {
+	_, err := c.do(http.MethodDelete, "data", path, nil, nil)
+	return err
+}
+
+// do sends request to the Vault API. It returns false if the path is not
+// found.
+func (c *client) do(method, endpoint, path string, req, res interface{}) (bool, error) {
+	var body []byte
+	if req != nil {
+		var err error
+		if body, err = json.Marshal(req); err != nil {
+			return false, err
+		}
+	}
+
+	url := fmt.Sprintf("%v/v1/%v/%v/%v", c.addr, c.mount, endpoint, strings.TrimLeft(path, "/"))
+	r, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	r.Header.Set("X-Vault-Token", c.token)
+
+	resp, err := c.http.Do(r)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, errors.Wrap(err, "reading Vault response failed")
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		// deleted secrets are reported as not found but still have metadata
+		if res != nil && len(data) > 0 {
+			json.Unmarshal(data, res)
+		}
+		return false, nil
+	case resp.StatusCode >= 300:
+		e := errorResponse{}
+		if err := json.Unmarshal(data, &e); err == nil && len(e.Errors) > 0 {
+			return false, fmt.Errorf("vault %v %v: %v", method, path, strings.Join(e.Errors, "; "))
+		}
+		return false, fmt.Errorf("vault %v %v: unexpected status %v", method, path, resp.Status)
+	}
+
+	if res == nil || len(data) == 0 {
+		return true, nil
+	}
+
+	return true, errors.Wrap(json.Unmarshal(data, res), "parsing Vault response failed")
+}
@@ -0,0 +1,330 @@
+package vault
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/miracl/casper"
+	"github.com/miracl/casper/consul"
+	"github.com/miracl/casper/diff"
+	"github.com/pkg/errors"
+)
+
+// DefaultIgnoreVal is the default value that need to be set for a key to be
+// ignored.
+const DefaultIgnoreVal = "_ignore"
+
+// DefaultMount is the default mount path of the KV v2 secrets engine.
+const DefaultMount = "secret"
+
+const (
+	folderValKey = "_value"
+	maskedVal    = "******"
+)
+
+// kv is interface that the Vault client implements.
+// Defined and used mainly for testing.
+type kv interface {
+	List(path string) ([]string, error)
+	Read(path string) (*secret, error)
+	Version(path string) (int, error)
+	Write(path string, data map[string]string, cas int) error
+	Delete(path string) error
+}
+
+// Storage is an implementation of the storage interface that stores in Vault
+// KV v2 secrets engine. The flattened keys are mapped to secrets under the
+// storage path - the last part of the key is the field of the secret and
+// the rest is the path of the secret.
+type Storage struct {
+	kv        kv
+	path      string
+	ignoreVal string
+	mask      bool
+	lists     consul.ListMode
+}
+
+// New returns new Vault storage. If the address has no token VAULT_TOKEN
+// environment variable is used.
+func New(addr string) (*Storage, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing Vault address %v failed", addr)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid Vault address %v", addr)
+	}
+
+	q := u.Query()
+	p := strings.Trim(q.Get("path"), "/")
+	if p == "" {
+		return nil, fmt.Errorf("missing secrets path in Vault address %v", addr)
+	}
+
+	token := q.Get("token")
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+
+	mount := strings.Trim(q.Get("mount"), "/")
+	if mount == "" {
+		mount = DefaultMount
+	}
+
+	ignore := q.Get("ignore")
+	if ignore == "" {
+		ignore = DefaultIgnoreVal
+	}
+
+	lists, err := consul.ParseListMode(q.Get("lists"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing Vault address %v failed", addr)
+	}
+
+	c := newClient(fmt.Sprintf("%v://%v", u.Scheme, u.Host), token, mount)
+	return &Storage{c, p, ignore, q.Get("mask") != "false", lists}, nil
+}
+
+func (s Storage) String(format string) (string, error) {
+	secrets, err := s.secrets()
+	if err != nil {
+		return "", err
+	}
+
+	return consul.KVPairsToString(secretsToPairs(secrets), format, s.lists), nil
+}
+
+// GetChanges returns changes between the config and the Storage content.
+func (s Storage) GetChanges(config []byte, format, key string) (casper.Changes, error) {
+	secrets, err := s.secrets()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting secrets from Vault failed")
+	}
+
+	kvChanges, err := consul.KVChanges(secretsToPairs(secrets), config, format, key, s.ignoreVal, s.lists)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := kvChanges
+	if s.mask {
+		keys = maskChanges(kvChanges)
+	}
+
+	return &changes{kvChanges, secrets, keys}, nil
+}
+
+// Lists returns how the storage flattens the lists of the config.
+func (s Storage) Lists() consul.ListMode {
+	return s.lists
+}
+
+// Diff returns the visual representation of the changes. The values are
+// masked unless the storage is created with mask=false.
+func (s Storage) Diff(cs casper.Changes, pretty bool) string {
+	kvChanges := cs.(*changes).KVChanges
+	if !s.mask {
+		return diff.Diff(kvChanges, pretty)
+	}
+
+	return diff.Diff(maskChanges(kvChanges), pretty)
+}
+
+// maskChanges returns the changes with the values replaced by maskedVal.
+func maskChanges(kvChanges diff.KVChanges) diff.KVChanges {
+	masked := diff.KVChanges{}
+	for _, c := range kvChanges {
+		switch c.(type) {
+		case *diff.Add:
+			masked = append(masked, diff.NewAdd(c.Key(), maskedVal))
+		case *diff.Update:
+			masked = append(masked, diff.NewUpdate(c.Key(), maskedVal, maskedVal))
+		case *diff.Remove:
+			masked = append(masked, diff.NewRemove(c.Key(), maskedVal))
+		}
+	}
+	return masked
+}
+
+// Push changes to the storage. Each secret is written with check-and-set
+// set to the version read in GetChanges so concurrent changes are detected.
+// Vault has no check-and-set for deletes so the current version of the
+// secret is compared with the read one right before deleting it.
+func (s Storage) Push(cs casper.Changes) error {
+	c := cs.(*changes)
+
+	// group the changes by secret
+	updated := map[string]map[string]string{}
+	for _, ci := range c.KVChanges {
+		p, field := splitKey(ci.Key())
+		data, ok := updated[p]
+		if !ok {
+			data = map[string]string{}
+			if cur, ok := c.secrets[p]; ok && cur != nil {
+				for k, v := range cur.data {
+					data[k] = v
+				}
+			}
+			updated[p] = data
+		}
+
+		switch v := ci.(type) {
+		case *diff.Add:
+			data[field] = v.Val()
+		case *diff.Update:
+			data[field] = v.NewVal()
+		case *diff.Remove:
+			delete(data, field)
+		default:
+			return fmt.Errorf("invalid change type: %T", ci)
+		}
+	}
+
+	paths := make([]string, 0, len(updated))
+	for p := range updated {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		full := path.Join(s.path, p)
+		if len(updated[p]) == 0 {
+			read := 0
+			if cur := c.secrets[p]; cur != nil {
+				read = cur.version
+			}
+
+			version, err := s.kv.Version(full)
+			if err != nil {
+				return errors.Wrapf(err, "getting version of secret %v failed", full)
+			}
+
+			if version != read {
+				return fmt.Errorf("deleting secret %v failed: current version %v doesn't match the read version %v", full, version, read)
+			}
+
+			if err := s.kv.Delete(full); err != nil {
+				return errors.Wrapf(err, "deleting secret %v failed", full)
+			}
+			continue
+		}
+
+		cas := 0
+		if cur := c.secrets[p]; cur != nil {
+			cas = cur.version
+		}
+
+		if err := s.kv.Write(full, updated[p], cas); err != nil {
+			return errors.Wrapf(err, "writing secret %v failed", full)
+		}
+	}
+
+	return nil
+}
+
+// secrets returns all secrets under the storage path indexed by their path
+// relative to it.
+func (s Storage) secrets() (map[string]*secret, error) {
+	secrets := map[string]*secret{}
+	if err := s.read("", secrets); err != nil {
+		return nil, err
+	}
+
+	if err := s.walk("", secrets); err != nil {
+		return nil, err
+	}
+
+	return secrets, nil
+}
+
+func (s Storage) walk(rel string, secrets map[string]*secret) error {
+	keys, err := s.kv.List(path.Join(s.path, rel))
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		child := path.Join(rel, strings.TrimSuffix(k, "/"))
+		if strings.HasSuffix(k, "/") {
+			err = s.walk(child, secrets)
+		} else {
+			err = s.read(child, secrets)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s Storage) read(rel string, secrets map[string]*secret) error {
+	sec, err := s.kv.Read(path.Join(s.path, rel))
+	if err != nil {
+		return err
+	}
+
+	if sec != nil {
+		secrets[rel] = sec
+	}
+
+	return nil
+}
+
+type changes struct {
+	diff.KVChanges
+	secrets map[string]*secret
+	// keys are the changes shown by KeyChanges, masked like in Diff
+	keys diff.KVChanges
+}
+
+// KeyChanges returns the changes of the keys in the config.
+func (c changes) KeyChanges() diff.KVChanges {
+	return c.keys
+}
+
+// secretsToPairs flattens the secrets to key/value pairs.
+func secretsToPairs(secrets map[string]*secret) api.KVPairs {
+	pairs := api.KVPairs{}
+	for p, sec := range secrets {
+		for field, val := range sec.data {
+			pairs = append(pairs, &api.KVPair{Key: joinKey(p, field), Value: []byte(val)})
+		}
+	}
+
+	return pairs
+}
+
+// joinKey returns the flattened key for the field of the secret at path p.
+func joinKey(p, field string) string {
+	if field == folderValKey {
+		return p + "/"
+	}
+
+	if p == "" {
+		return field
+	}
+
+	return p + "/" + field
+}
+
+// splitKey returns the secret path and the field for the flattened key.
+func splitKey(key string) (string, string) {
+	if strings.HasSuffix(key, "/") {
+		return strings.TrimSuffix(key, "/"), folderValKey
+	}
+
+	i := strings.LastIndex(key, "/")
+	if i < 0 {
+		return "", key
+	}
+
+	return key[:i], key[i+1:]
+}
@@ -0,0 +1,390 @@
+package vault
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/miracl/casper/consul"
+)
+
+// It is defined in each package so you can run `go test ./...`
+var full = flag.Bool("full", false, "Run all tests including integration")
+
+const testToken = "the_one_ring"
+
+// vaultMock is an in-memory stand-in of the Vault KV v2 API mounted at secret.
+type vaultMock struct {
+	secrets map[string]*mockSecret
+}
+
+type mockSecret struct {
+	versions []map[string]string // nil for deleted versions
+}
+
+func newVaultMock(secrets map[string]map[string]string) *vaultMock {
+	v := &vaultMock{map[string]*mockSecret{}}
+	for p, data := range secrets {
+		v.secrets[p] = &mockSecret{[]map[string]string{data}}
+	}
+	return v
+}
+
+func (v *vaultMock) data(p string) map[string]string {
+	s, ok := v.secrets[p]
+	if !ok {
+		return nil
+	}
+	return s.versions[len(s.versions)-1]
+}
+
+func (v *vaultMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Vault-Token") != testToken {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"errors":["permission denied"]}`)
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/v1/"), "/", 3)
+	if len(parts) < 2 || parts[0] != "secret" {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"errors":[]}`)
+		return
+	}
+	p := ""
+	if len(parts) == 3 {
+		p = parts[2]
+	}
+
+	switch {
+	case parts[1] == "metadata" && r.Method == "LIST":
+		keys := map[string]bool{}
+		for sp := range v.secrets {
+			if !strings.HasPrefix(sp, p+"/") {
+				continue
+			}
+			rest := strings.TrimPrefix(sp, p+"/")
+			if i := strings.Index(rest, "/"); i >= 0 {
+				keys[rest[:i+1]] = true
+			} else {
+				keys[rest] = true
+			}
+		}
+		if len(keys) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors":[]}`)
+			return
+		}
+		res := listResponse{}
+		for k := range keys {
+			res.Data.Keys = append(res.Data.Keys, k)
+		}
+		sort.Strings(res.Data.Keys)
+		json.NewEncoder(w).Encode(res)
+	case parts[1] == "metadata" && r.Method == http.MethodGet:
+		s, ok := v.secrets[p]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors":[]}`)
+			return
+		}
+		fmt.Fprintf(w, `{"data":{"current_version":%v}}`, len(s.versions))
+	case parts[1] == "data" && r.Method == http.MethodGet:
+		s, ok := v.secrets[p]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors":[]}`)
+			return
+		}
+		res := map[string]interface{}{
+			"data": map[string]interface{}{
+				"data":     s.versions[len(s.versions)-1],
+				"metadata": map[string]interface{}{"version": len(s.versions)},
+			},
+		}
+		if s.versions[len(s.versions)-1] == nil {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		json.NewEncoder(w).Encode(res)
+	case parts[1] == "data" && r.Method == http.MethodPost:
+		req := writeRequest{}
+		json.NewDecoder(r.Body).Decode(&req)
+		s, ok := v.secrets[p]
+		if !ok {
+			s = &mockSecret{}
+		}
+		if req.Options.CAS != len(s.versions) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errors":["check-and-set parameter did not match the current version"]}`)
+			return
+		}
+		s.versions = append(s.versions, req.Data)
+		v.secrets[p] = s
+		fmt.Fprintf(w, `{"data":{"version":%v}}`, len(s.versions))
+	case parts[1] == "data" && r.Method == http.MethodDelete:
+		if s, ok := v.secrets[p]; ok {
+			s.versions = append(s.versions, nil)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		fmt.Fprint(w, `{"errors":["unsupported operation"]}`)
+	}
+}
+
+func TestNewVaultStorage(t *testing.T) {
+	testCases := []struct {
+		addr string
+		path string
+		mask bool
+		ok   bool
+	}{
+		{"http://127.0.0.1:8200/?path=app&token=t", "app", true, true},
+		{"http://127.0.0.1:8200/?path=/app/db/&mount=kv&mask=false", "app/db", false, true},
+		{"http://127.0.0.1:8200/?path=app&lists=join", "app", true, true},
+		{"http://127.0.0.1:8200/?path=app&lists=other", "", false, false},
+		{"http://127.0.0.1:8200/?token=t", "", false, false},
+		{"", "", false, false},
+		{"http://192.168.0.%31/", "", false, false},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			s, err := New(tc.addr)
+			if tc.ok != (err == nil) {
+				if err != nil {
+					t.Fatal(err)
+				} else {
+					t.Fatal("Should fail")
+				}
+			}
+
+			if !tc.ok {
+				return
+			}
+
+			if s.path != tc.path || s.mask != tc.mask {
+				t.Errorf("Got path %v, mask %v; want %v, %v", s.path, s.mask, tc.path, tc.mask)
+			}
+		})
+	}
+}
+
+func TestVaultStorageString(t *testing.T) {
+	srv := httptest.NewServer(newVaultMock(map[string]map[string]string{
+		"app":         {"key1": "val1"},
+		"app/db":      {"_value": "db", "password": "secret"},
+		"app/db/pool": {"size": "10"},
+		"other":       {"key": "val"},
+	}))
+	defer srv.Close()
+
+	s := &Storage{newClient(srv.URL, testToken, "secret"), "app", DefaultIgnoreVal, true, consul.IndexedLists}
+	str, err := s.String("jsonraw")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `{"db":{"_value":"db","password":"secret","pool":{"size":"10"}},"key1":"val1"}`
+	if str != exp {
+		t.Errorf("Got `%v`; want `%v`", str, exp)
+	}
+
+	s.kv = newClient(srv.URL, "invalid", "secret")
+	if _, err := s.String("jsonraw"); err == nil {
+		t.Error("Should fail with invalid token")
+	}
+}
+
+func TestVaultStoragePush(t *testing.T) {
+	testCases := []struct {
+		secrets map[string]map[string]string
+		config  string
+		mask    bool
+		diff    string
+		exp     map[string]map[string]string
+	}{
+		{
+			map[string]map[string]string{
+				"app":    {"key1": "val1", "key2": "val2"},
+				"app/db": {"user": "admin", "password": "old"},
+			},
+			`{"key1":"val1","db":{"user":"admin","password":"new"},"api":{"token":"t"}}`,
+			true,
+			"" +
+				"+api/token=******\n" +
+				"-db/password=******\n" +
+				"+db/password=******\n" +
+				"-key2=******\n",
+			map[string]map[string]string{
+				"app":     {"key1": "val1"},
+				"app/db":  {"user": "admin", "password": "new"},
+				"app/api": {"token": "t"},
+			},
+		},
+		{
+			map[string]map[string]string{
+				"app":    {"key1": "val1"},
+				"app/db": {"password": "old"},
+			},
+			`{"key1":"val2","db":{"_value":"db"},"ignored":"_ignore"}`,
+			false,
+			"" +
+				"+db/=db\n" +
+				"-db/password=old\n" +
+				"-key1=val1\n" +
+				"+key1=val2\n",
+			map[string]map[string]string{
+				"app":    {"key1": "val2"},
+				"app/db": {"_value": "db"},
+			},
+		},
+		{
+			map[string]map[string]string{
+				"app":    {"key1": "val1"},
+				"app/db": {"password": "old"},
+			},
+			`{"key1":"val1"}`,
+			true,
+			"-db/password=******\n",
+			map[string]map[string]string{
+				"app":    {"key1": "val1"},
+				"app/db": nil,
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			v := newVaultMock(tc.secrets)
+			srv := httptest.NewServer(v)
+			defer srv.Close()
+
+			s := &Storage{newClient(srv.URL, testToken, "secret"), "app", DefaultIgnoreVal, tc.mask, consul.IndexedLists}
+
+			cs, err := s.GetChanges([]byte(tc.config), "json", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			diff := s.Diff(cs, false)
+			if diff != tc.diff {
+				t.Errorf("Got `%v`; want `%v`", diff, tc.diff)
+			}
+
+			if err := s.Push(cs); err != nil {
+				t.Fatal(err)
+			}
+
+			for p, exp := range tc.exp {
+				if got := v.data(p); !reflect.DeepEqual(got, exp) {
+					t.Errorf("Got %v=%v; want %v", p, got, exp)
+				}
+			}
+
+			// no changes after the push
+			cs, err = s.GetChanges([]byte(tc.config), "json", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cs.Len() != 0 {
+				t.Errorf("Got changes after push: %v", s.Diff(cs, false))
+			}
+		})
+	}
+}
+
+func TestVaultStoragePushConflict(t *testing.T) {
+	v := newVaultMock(map[string]map[string]string{
+		"app": {"key1": "val1"},
+	})
+	srv := httptest.NewServer(v)
+	defer srv.Close()
+
+	s := &Storage{newClient(srv.URL, testToken, "secret"), "app", DefaultIgnoreVal, true, consul.IndexedLists}
+
+	cs, err := s.GetChanges([]byte(`{"key1":"val2"}`), "json", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent writer
+	v.secrets["app"].versions = append(v.secrets["app"].versions, map[string]string{"key1": "other"})
+
+	err = s.Push(cs)
+	if err == nil {
+		t.Fatal("Push should fail")
+	}
+
+	if !strings.Contains(err.Error(), "check-and-set") {
+		t.Errorf("Got %v; want check-and-set error", err)
+	}
+
+	if got := v.data("app")["key1"]; got != "other" {
+		t.Errorf("Got %v; want other", got)
+	}
+}
+
+func TestVaultStorageDeleteConflict(t *testing.T) {
+	v := newVaultMock(map[string]map[string]string{
+		"app/db": {"password": "val1"},
+	})
+	srv := httptest.NewServer(v)
+	defer srv.Close()
+
+	s := &Storage{newClient(srv.URL, testToken, "secret"), "app", DefaultIgnoreVal, true, consul.IndexedLists}
+
+	cs, err := s.GetChanges([]byte(`{}`), "json", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent writer
+	v.secrets["app/db"].versions = append(v.secrets["app/db"].versions, map[string]string{"password": "other"})
+
+	err = s.Push(cs)
+	if err == nil {
+		t.Fatal("Push should fail")
+	}
+
+	if !strings.Contains(err.Error(), "doesn't match the read version") {
+		t.Errorf("Got %v; want version mismatch error", err)
+	}
+
+	if got := v.data("app/db")["password"]; got != "other" {
+		t.Errorf("Got %v; want other", got)
+	}
+}
+
+func TestSplitKey(t *testing.T) {
+	testCases := []struct {
+		key   string
+		path  string
+		field string
+	}{
+		{"key", "", "key"},
+		{"db/password", "db", "password"},
+		{"db/pool/size", "db/pool", "size"},
+		{"db/", "db", folderValKey},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			p, field := splitKey(tc.key)
+			if p != tc.path || field != tc.field {
+				t.Errorf("Got %v, %v; want %v, %v", p, field, tc.path, tc.field)
+			}
+
+			if key := joinKey(p, field); key != tc.key {
+				t.Errorf("Got %v; want %v", key, tc.key)
+			}
+		})
+	}
+}
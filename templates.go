@@ -0,0 +1,129 @@
+package casper
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// PartialPrefix starts the names of the files in a template directory that
+// only define templates used by the main template, e.g. _logging.yaml.
+const PartialPrefix = "_"
+
+// maxIncludeDepth limits the nested includes so a template including itself
+// fails instead of running out of stack.
+const maxIncludeDepth = 1000
+
+// TemplateFiles returns the files in the directory or the files matching
+// the glob pattern in lexical order. A file is returned as it is.
+func TemplateFiles(pattern string) ([]string, error) {
+	if info, err := os.Stat(pattern); err == nil {
+		if !info.IsDir() {
+			return []string{pattern}, nil
+		}
+		pattern = filepath.Join(pattern, "*")
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing template pattern %v failed", pattern)
+	}
+
+	files := []string{}
+	for _, m := range matches {
+		if info, err := os.Stat(m); err == nil && !info.IsDir() {
+			files = append(files, m)
+		}
+	}
+	sort.Strings(files)
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no templates match %v", pattern)
+	}
+	return files, nil
+}
+
+// SplitTemplates returns the main template and the partials in the
+// directory or the glob pattern. The partials are the files with names
+// starting with PartialPrefix and there must be exactly one other file.
+func SplitTemplates(pattern string) (string, []string, error) {
+	files, err := TemplateFiles(pattern)
+	if err != nil {
+		return "", nil, err
+	}
+
+	mains, partials := []string{}, []string{}
+	for _, f := range files {
+		if len(files) > 1 && strings.HasPrefix(filepath.Base(f), PartialPrefix) {
+			partials = append(partials, f)
+			continue
+		}
+		mains = append(mains, f)
+	}
+
+	switch len(mains) {
+	case 0:
+		return "", nil, fmt.Errorf("template %v has no main template", pattern)
+	case 1:
+		return mains[0], partials, nil
+	}
+	return "", nil, fmt.Errorf("template %v has several main templates: %v", pattern, strings.Join(mains, ", "))
+}
+
+// parseTemplate parses the template and all the partials into one set. The
+// partials are files, directories or glob patterns and each file is also a
+// template named after the file.
+func parseTemplate(body string, partials []string) (*template.Template, error) {
+	t := template.New("config").Funcs(funcMap)
+	t.Funcs(template.FuncMap{"include": include(t)})
+
+	if _, err := t.Parse(body); err != nil {
+		return nil, errors.Wrap(err, "template error")
+	}
+
+	for _, p := range partials {
+		files, err := TemplateFiles(p)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range files {
+			data, err := ioutil.ReadFile(f)
+			if err != nil {
+				return nil, errors.Wrapf(err, "reading template %v failed", f)
+			}
+
+			if _, err := t.New(filepath.Base(f)).Parse(string(data)); err != nil {
+				return nil, errors.Wrapf(err, "parsing template %v failed", f)
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// include returns a function that executes the template with the name in
+// the set of t and returns the result so it can be piped, e.g.
+// {{include "logging" . | indent 2}}.
+func include(t *template.Template) func(string, interface{}) (string, error) {
+	depth := 0
+	return func(name string, data interface{}) (string, error) {
+		if depth >= maxIncludeDepth {
+			return "", fmt.Errorf("include of %v is nested too deep", name)
+		}
+
+		depth++
+		defer func() { depth-- }()
+
+		var buf bytes.Buffer
+		err := t.ExecuteTemplate(&buf, name, data)
+		return buf.String(), err
+	}
+}
@@ -0,0 +1,152 @@
+package casper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/miracl/casper/source"
+)
+
+func TestSplitTemplates(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	dir, err := ioutil.TempDir("", "casper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := []string{"svc/_logging.yaml", "svc/config.yaml", "svc/sub/ignored.yaml", "two/a.yaml", "two/b.yaml", "partials/_a.yaml", "partials/_b.yaml"}
+	for _, f := range files {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		pattern  string
+		main     string
+		partials []string
+		err      string
+	}{
+		{"svc", "svc/config.yaml", []string{"svc/_logging.yaml"}, ""},
+		{"svc/*.yaml", "svc/config.yaml", []string{"svc/_logging.yaml"}, ""},
+		{"svc/config.yaml", "svc/config.yaml", []string{}, ""},
+		{"svc/_logging.yaml", "svc/_logging.yaml", []string{}, ""},
+		{"two", "", nil, "template two has several main templates"},
+		{"partials", "", nil, "template partials has no main template"},
+		{"missing/*", "", nil, "no templates match missing/*"},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			os.Chdir(dir)
+
+			main, partials, err := SplitTemplates(tc.pattern)
+			if (tc.err == "") != (err == nil) {
+				if err != nil {
+					t.Fatal(err)
+				} else {
+					t.Fatal("SplitTemplates should have failed but haven't")
+				}
+			}
+
+			if err != nil {
+				if !strings.HasPrefix(err.Error(), tc.err) {
+					t.Errorf("Got %v; want %v", err, tc.err)
+				}
+				return
+			}
+
+			if main != tc.main {
+				t.Errorf("Got %v; want %v", main, tc.main)
+			}
+			if !reflect.DeepEqual(partials, tc.partials) {
+				t.Errorf("Got %v; want %v", partials, tc.partials)
+			}
+		})
+	}
+}
+
+func TestBuildPartials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "casper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"shared/logging.tmpl": `{{define "logging"}}level: {{.level}}{{end}}`,
+		"shared/tracing.tmpl": `{{define "tracing"}}enabled: {{.tracing}}{{end}}`,
+		"_db.yaml":            "host: {{.db.host}}",
+		"loop.tmpl":           `{{define "loop"}}{{include "loop" .}}{{end}}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		tmpl     string
+		partials []string
+		res      string
+		err      string
+	}{
+		{`{{template "logging" .}}`, []string{filepath.Join(dir, "shared")}, "level: info", ""},
+		{"log:{{include \"logging\" . | nindent 2}}\ntracing:{{include \"tracing\" . | nindent 2}}", []string{filepath.Join(dir, "shared/*.tmpl")}, "log:\n  level: info\ntracing:\n  enabled: true", ""},
+		{`{{template "_db.yaml" .}}`, []string{filepath.Join(dir, "_db.yaml")}, "host: localhost", ""},
+		{`{{include "loop" .}}`, []string{filepath.Join(dir, "loop.tmpl")}, "", "include of loop is nested too deep"},
+		{`{{include "missing" .}}`, nil, "", `no template "missing"`},
+		{`{{template "logging" .}}`, []string{filepath.Join(dir, "missing")}, "", "no templates match"},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			config, err := BuildConfig{
+				Template: strings.NewReader(tc.tmpl),
+				Source: source.NewSource(map[string]interface{}{
+					"level":   "info",
+					"tracing": true,
+					"db":      map[string]interface{}{"host": "localhost"},
+				}),
+				Partials: tc.partials,
+			}.Build()
+			if (tc.err == "") != (err == nil) {
+				if err != nil {
+					t.Fatal(err)
+				} else {
+					t.Fatal("Build should have failed but haven't")
+				}
+			}
+
+			if err != nil {
+				if !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("Got %v; want %v", err, tc.err)
+				}
+				return
+			}
+
+			if string(config) != tc.res {
+				t.Errorf("Got %v; want %v", string(config), tc.res)
+			}
+		})
+	}
+}
@@ -1,9 +1,19 @@
 package casper
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
 )
 
 func isLast(x int, a interface{}) bool {
@@ -14,20 +24,404 @@ func isNotLast(x int, a interface{}) bool {
 	return x != reflect.ValueOf(a).Len()-1
 }
 
+// quote returns the value as a double-quoted string.
 func quote(a interface{}) string {
 	if a == nil {
 		return `""`
 	}
 
-	var s string
+	return strconv.Quote(toString(a))
+}
+
+func toString(a interface{}) string {
 	switch v := a.(type) {
+	case nil:
+		return ""
 	case string:
-		s = v
-	case int:
-		s = strconv.Itoa(v)
-	default:
-		s = "Unable to quote"
+		return v
+	case []byte:
+		return string(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	return fmt.Sprint(a)
+}
+
+// isEmpty reports whether the value is nil, zero or an empty collection.
+func isEmpty(a interface{}) bool {
+	if a == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(a)
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+// defaultValue returns the value if it is not empty or def otherwise, e.g.
+// {{.port | default 8080}}.
+func defaultValue(def, a interface{}) interface{} {
+	if isEmpty(a) {
+		return def
+	}
+	return a
+}
+
+// required fails the build if the value is nil or an empty string, e.g.
+// {{required "db.host" .db.host}}.
+func required(name string, a interface{}) (interface{}, error) {
+	if a == nil {
+		return nil, fmt.Errorf("value %v is required", name)
 	}
+	if s, ok := a.(string); ok && s == "" {
+		return nil, fmt.Errorf("value %v is required", name)
+	}
+	return a, nil
+}
+
+func toJSON(a interface{}) (string, error) {
+	data, err := json.Marshal(normalize(a))
+	return string(data), err
+}
+
+func toYAML(a interface{}) (string, error) {
+	data, err := yaml.Marshal(a)
+	return strings.TrimSuffix(string(data), "\n"), err
+}
+
+// indent indents all lines of s with n spaces.
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+}
+
+// nindent is like indent but starts with a new line, e.g.
+// `db:{{.db | toYaml | nindent 2}}`.
+func nindent(n int, s string) string {
+	return "\n" + indent(n, s)
+}
+
+func replace(old, new, s string) string {
+	return strings.Replace(s, old, new, -1)
+}
+
+func split(sep, s string) []string {
+	return strings.Split(s, sep)
+}
+
+func join(sep string, a interface{}) (string, error) {
+	list, err := toList(a)
+	if err != nil {
+		return "", err
+	}
+
+	strs := make([]string, len(list))
+	for i, v := range list {
+		strs[i] = toString(v)
+	}
+	return strings.Join(strs, sep), nil
+}
+
+// dict creates a map from key/value pairs.
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("dict requires key/value pairs")
+	}
+
+	m := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		m[toString(pairs[i])] = pairs[i+1]
+	}
+	return m, nil
+}
+
+func list(items ...interface{}) []interface{} {
+	return items
+}
+
+// keys returns the sorted keys of the map.
+func keys(a interface{}) ([]string, error) {
+	m, err := toMap(a)
+	if err != nil {
+		return nil, err
+	}
+
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks, nil
+}
+
+// values returns the values of the map sorted by their keys.
+func values(a interface{}) ([]interface{}, error) {
+	m, err := toMap(a)
+	if err != nil {
+		return nil, err
+	}
+
+	ks, _ := keys(m)
+	vals := make([]interface{}, len(ks))
+	for i, k := range ks {
+		vals[i] = m[k]
+	}
+	return vals, nil
+}
+
+func hasKey(a interface{}, key string) (bool, error) {
+	m, err := toMap(a)
+	if err != nil {
+		return false, err
+	}
+
+	_, ok := m[key]
+	return ok, nil
+}
+
+// pluck returns the values of the key in the maps that have it.
+func pluck(key string, maps ...interface{}) ([]interface{}, error) {
+	vals := []interface{}{}
+	for _, a := range maps {
+		m, err := toMap(a)
+		if err != nil {
+			return nil, err
+		}
+
+		if v, ok := m[key]; ok {
+			vals = append(vals, v)
+		}
+	}
+	return vals, nil
+}
+
+// merge returns new map with the values of the maps. The values in the
+// earlier maps take precedence and nested maps are merged.
+func merge(maps ...interface{}) (map[string]interface{}, error) {
+	merged := map[string]interface{}{}
+	for i := len(maps) - 1; i >= 0; i-- {
+		m, err := toMap(maps[i])
+		if err != nil {
+			return nil, err
+		}
 
-	return fmt.Sprintf("%#v", s)
+		for k, v := range m {
+			prev, prevErr := toMap(merged[k])
+			next, nextErr := toMap(v)
+			if merged[k] != nil && prevErr == nil && nextErr == nil {
+				if merged[k], err = merge(next, prev); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			merged[k] = v
+		}
+	}
+	return merged, nil
+}
+
+// add returns the sum of the numbers. The result is a float if either of
+// them is a float and an integer otherwise. The same applies to the other
+// arithmetic functions.
+func add(a, b interface{}) (interface{}, error) {
+	return arith(a, b, func(x, y int64) int64 { return x + y }, func(x, y float64) float64 { return x + y })
+}
+
+func sub(a, b interface{}) (interface{}, error) {
+	return arith(a, b, func(x, y int64) int64 { return x - y }, func(x, y float64) float64 { return x - y })
+}
+
+func mul(a, b interface{}) (interface{}, error) {
+	return arith(a, b, func(x, y int64) int64 { return x * y }, func(x, y float64) float64 { return x * y })
+}
+
+func div(a, b interface{}) (interface{}, error) {
+	x, y, err := toNumbers(a, b)
+	if err == nil && y.isZero() {
+		err = errors.New("division by zero")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if x.isFloat || y.isFloat {
+		return x.float() / y.float(), nil
+	}
+	return x.i / y.i, nil
+}
+
+func mod(a, b interface{}) (interface{}, error) {
+	x, y, err := toNumbers(a, b)
+	if err == nil && y.isZero() {
+		err = errors.New("division by zero")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if x.isFloat || y.isFloat {
+		return math.Mod(x.float(), y.float()), nil
+	}
+	return x.i % y.i, nil
+}
+
+func maxValue(a, b interface{}) (interface{}, error) {
+	return arith(a, b,
+		func(x, y int64) int64 {
+			if x < y {
+				return y
+			}
+			return x
+		},
+		math.Max,
+	)
+}
+
+func minValue(a, b interface{}) (interface{}, error) {
+	return arith(a, b,
+		func(x, y int64) int64 {
+			if x > y {
+				return y
+			}
+			return x
+		},
+		math.Min,
+	)
+}
+
+// arith applies the integer or the float operation to the numbers.
+func arith(a, b interface{}, intOp func(x, y int64) int64, floatOp func(x, y float64) float64) (interface{}, error) {
+	x, y, err := toNumbers(a, b)
+	if err != nil {
+		return nil, err
+	}
+
+	if x.isFloat || y.isFloat {
+		return floatOp(x.float(), y.float()), nil
+	}
+	return intOp(x.i, y.i), nil
+}
+
+func b64enc(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func b64dec(s string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	return string(data), err
+}
+
+func sha256sum(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// number is an integer or a float value.
+type number struct {
+	i       int64
+	f       float64
+	isFloat bool
+}
+
+func (n number) float() float64 {
+	if n.isFloat {
+		return n.f
+	}
+	return float64(n.i)
+}
+
+func (n number) isZero() bool {
+	return n.float() == 0
+}
+
+func toNumbers(a, b interface{}) (number, number, error) {
+	x, err := toNumber(a)
+	if err != nil {
+		return number{}, number{}, err
+	}
+
+	y, err := toNumber(b)
+	return x, y, err
+}
+
+// toNumber converts the value to a number. The errors don't include the
+// value as it can be a secret.
+func toNumber(a interface{}) (number, error) {
+	v := reflect.ValueOf(a)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return number{i: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() > math.MaxInt64 {
+			return number{}, fmt.Errorf("%T is out of range", a)
+		}
+		return number{i: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return number{f: v.Float(), isFloat: true}, nil
+	case reflect.String:
+		if i, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+			return number{i: i}, nil
+		}
+		if f, err := strconv.ParseFloat(v.String(), 64); err == nil {
+			return number{f: f, isFloat: true}, nil
+		}
+		return number{}, fmt.Errorf("%T is not a number", a)
+	}
+	return number{}, fmt.Errorf("%T is not a number", a)
+}
+
+func toList(a interface{}) ([]interface{}, error) {
+	v := reflect.ValueOf(a)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%T is not a list", a)
+	}
+
+	list := make([]interface{}, v.Len())
+	for i := range list {
+		list[i] = v.Index(i).Interface()
+	}
+	return list, nil
+}
+
+// toMap returns the map with string keys. The yaml maps are converted.
+func toMap(a interface{}) (map[string]interface{}, error) {
+	switch m := a.(type) {
+	case map[string]interface{}:
+		return m, nil
+	case map[interface{}]interface{}:
+		c := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			c[toString(k)] = v
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("%T is not a map", a)
+}
+
+// normalize converts the yaml maps in a to maps with string keys so it can
+// be encoded to json.
+func normalize(a interface{}) interface{} {
+	switch v := a.(type) {
+	case map[string]interface{}, map[interface{}]interface{}:
+		m, _ := toMap(v)
+		c := make(map[string]interface{}, len(m))
+		for k, vi := range m {
+			c[k] = normalize(vi)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, vi := range v {
+			c[i] = normalize(vi)
+		}
+		return c
+	}
+	return a
 }
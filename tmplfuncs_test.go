@@ -1,8 +1,13 @@
 package casper
 
 import (
+	"bytes"
 	"fmt"
+	"math"
+	"strings"
 	"testing"
+
+	"github.com/miracl/casper/source"
 )
 
 func TestIsLastAndIsNotLast(t *testing.T) {
@@ -41,7 +46,10 @@ func TestQuote(t *testing.T) {
 		{"", `""`},
 		{nil, `""`},
 		{"a", `"a"`},
-		{false, `"Unable to quote"`},
+		{false, `"false"`},
+		{0.5, `"0.5"`},
+		{1e21, `"1000000000000000000000"`},
+		{`say "hi"`, `"say \"hi\""`},
 	}
 
 	for i, tc := range testCases {
@@ -52,3 +60,83 @@ func TestQuote(t *testing.T) {
 		})
 	}
 }
+
+func TestTemplateFuncs(t *testing.T) {
+	values := map[string]interface{}{
+		"name":  "casper",
+		"empty": "",
+		"port":  8080,
+		"ratio": 0.5,
+		"small": uint8(3),
+		"big":   uint64(math.MaxUint64),
+		"hosts": []interface{}{"a", "b"},
+		"db": map[interface{}]interface{}{
+			"host": "localhost",
+			"opts": map[interface{}]interface{}{"ssl": true},
+		},
+		"other": map[string]interface{}{"host": "remote", "user": "admin"},
+	}
+
+	testCases := []struct {
+		tmpl string
+		res  string
+		err  string
+	}{
+		{`{{.empty | default "x"}} {{.name | default "x"}} {{.missing | default 1}}`, "x casper 1", ""},
+		{`{{required "name" .name}}`, "casper", ""},
+		{`{{required "empty" .empty}}`, "", "value empty is required"},
+		{`{{required "missing" .missing}}`, "", "value missing is required"},
+		{`{{.db | toJson}}`, `{"host":"localhost","opts":{"ssl":true}}`, ""},
+		{`{{.hosts | toJson}}`, `["a","b"]`, ""},
+		{"db:{{.db | toYaml | nindent 2}}", "db:\n  host: localhost\n  opts:\n    ssl: true", ""},
+		{`{{"a\nb" | indent 4}}`, "    a\n    b", ""},
+		{`{{upper .name}} {{lower "ABC"}} {{replace "a" "o" "casper"}} {{trim "  x "}}`, "CASPER abc cosper x", ""},
+		{`{{split "," "a,b,c" | join "-"}} {{join ", " .hosts}}`, "a-b-c a, b", ""},
+		{`{{join "," .name}}`, "", "string is not a list"},
+		{`{{keys .db}} {{values .other}} {{hasKey .db "host"}} {{hasKey .other "port"}}`, "[host opts] [remote admin] true false", ""},
+		{`{{pluck "host" .db .other (dict "user" "x")}}`, "[localhost remote]", ""},
+		{`{{$m := merge .other .db}}{{$m.host}} {{$m.user}} {{$m.opts.ssl}}`, "remote admin true", ""},
+		{`{{$m := merge (dict "opts" (dict "tls" 1)) .db}}{{$m.opts | toJson}}`, `{"ssl":true,"tls":1}`, ""},
+		{`{{dict "a"}}`, "", "dict requires key/value pairs"},
+		{`{{keys .name}}`, "", "string is not a map"},
+		{`{{add .port 1}} {{sub .port 80}} {{mul 2 "3"}} {{div 7 2}} {{mod 7 2}} {{max 2 .port}} {{min -1 2}}`, "8081 8000 6 3 1 8080 -1", ""},
+		{`{{add .ratio 1}} {{sub 1 .ratio}} {{mul .ratio "3"}} {{div 7.5 2}} {{mod 7.5 2}} {{max 1 .ratio}} {{min .ratio 1}} {{add "0.25" 1}}`, "1.5 0.5 1.5 3.75 1.5 1 0.5 1.25", ""},
+		{`{{add .small 1}} {{max .small 2}}`, "4 3", ""},
+		{`{{add .big 1}}`, "", "uint64 is out of range"},
+		{`{{div 1 0.0}}`, "", "division by zero"},
+		{`{{div 1 0}}`, "", "division by zero"},
+		{`{{add .name 1}}`, "", "string is not a number"},
+		{`{{add 1 .db}}`, "", "map[interface {}]interface {} is not a number"},
+		{`{{b64enc .name}} {{b64dec "Y2FzcGVy"}}`, "Y2FzcGVy casper", ""},
+		{`{{b64dec "!"}}`, "", "illegal base64 data at input byte 0"},
+		{`{{sha256sum .name}}`, "81fdff283ec2829b4002384ad18370f64e7a48618c45058e3d112d965e27f72e", ""},
+		{`{{quote .ratio}} {{quote .db.opts.ssl}} {{quote .missing}} {{list 1 "a" | toJson}}`, `"0.5" "true" "" [1,"a"]`, ""},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			res, err := BuildConfig{
+				Template: bytes.NewBufferString(tc.tmpl),
+				Source:   source.NewSource(values),
+			}.Build()
+			if (tc.err == "") != (err == nil) {
+				if err != nil {
+					t.Fatal(err)
+				} else {
+					t.Fatal("Build should have failed but haven't")
+				}
+			}
+
+			if err != nil {
+				if !strings.HasSuffix(err.Error(), tc.err) {
+					t.Errorf("Got %v; want %v", err, tc.err)
+				}
+				return
+			}
+
+			if string(res) != tc.res {
+				t.Errorf("Got %v; want %v", string(res), tc.res)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package casper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/pkg/errors"
+)
+
+// UnusedKeys returns the keys of the source values that are not referenced
+// by the template. The keys of nested values are joined with dots. The
+// template is analysed without executing it, so the values that are passed
+// to functions, ranged over or used through the root dot are considered
+// used with all values nested in them.
+func (c BuildConfig) UnusedKeys() ([]string, error) {
+	body, err := ioutil.ReadAll(c.Template)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading template failed")
+	}
+
+	t, err := parseTemplate(string(body), c.Partials)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &refWalker{
+		tmpl:    t,
+		whole:   map[string]bool{},
+		exact:   map[string]bool{},
+		vars:    map[string][]string{},
+		visited: map[string]bool{},
+	}
+	if t.Tree != nil {
+		w.walk(t.Tree.Root, []string{}, true)
+	}
+
+	unused := []string{}
+	for _, key := range leafKeys(c.Source.Get(), "") {
+		if !w.isUsed(key) {
+			unused = append(unused, key)
+		}
+	}
+	sort.Strings(unused)
+
+	return unused, nil
+}
+
+// leafKeys returns the keys of the values that are not maps. Empty maps are
+// leaves too.
+func leafKeys(v interface{}, prefix string) []string {
+	m, err := toMap(v)
+	if err != nil || (len(m) == 0 && prefix != "") {
+		return []string{strings.TrimSuffix(prefix, ".")}
+	}
+
+	keys := []string{}
+	for k, vi := range m {
+		keys = append(keys, leafKeys(vi, prefix+k+".")...)
+	}
+	return keys
+}
+
+// refWalker collects the paths of the values referenced in the template.
+type refWalker struct {
+	tmpl *template.Template
+	// whole are the values used with all values nested in them
+	whole map[string]bool
+	// exact are the values used only as a context, e.g. in with
+	exact   map[string]bool
+	vars    map[string][]string
+	visited map[string]bool
+}
+
+func (w *refWalker) isUsed(key string) bool {
+	if w.exact[key] || w.whole[""] {
+		return true
+	}
+
+	path := strings.Split(key, ".")
+	for i := range path {
+		if w.whole[strings.Join(path[:i+1], ".")] {
+			return true
+		}
+	}
+	return false
+}
+
+// walk walks the node with the path of the dot. The dot is not known in
+// range and in templates called with unknown values.
+func (w *refWalker) walk(node parse.Node, dot []string, known bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			w.walk(child, dot, known)
+		}
+	case *parse.ActionNode:
+		w.walkPipe(n.Pipe, dot, known)
+	case *parse.IfNode:
+		w.walkPipe(n.Pipe, dot, known)
+		w.walk(n.List, dot, known)
+		w.walk(n.ElseList, dot, known)
+	case *parse.WithNode:
+		if path, ok := w.resolvePipe(n.Pipe, dot, known); ok {
+			w.exact[strings.Join(path, ".")] = true
+			w.walk(n.List, path, true)
+		} else {
+			w.walkPipe(n.Pipe, dot, known)
+			w.walk(n.List, nil, false)
+		}
+		w.walk(n.ElseList, dot, known)
+	case *parse.RangeNode:
+		w.walkPipe(n.Pipe, dot, known)
+		w.walk(n.List, nil, false)
+		w.walk(n.ElseList, dot, known)
+	case *parse.TemplateNode:
+		path, ok := w.resolvePipe(n.Pipe, dot, known)
+		if !ok {
+			w.walkPipe(n.Pipe, dot, known)
+		}
+		w.call(n.Name, path, ok)
+	}
+}
+
+// call walks the template with the name called with the value on the path.
+func (w *refWalker) call(name string, path []string, known bool) {
+	t := w.tmpl.Lookup(name)
+	if t == nil || t.Tree == nil {
+		if known {
+			// the template is missing, so the value can't be followed
+			w.whole[strings.Join(path, ".")] = true
+		}
+		return
+	}
+
+	id := fmt.Sprintf("%v %v %v", name, path, known)
+	if !w.visited[id] {
+		w.visited[id] = true
+		w.walk(t.Tree.Root, path, known)
+	}
+}
+
+// walkPipe marks the values used in the pipeline. The values assigned to
+// variables are used only as a context.
+func (w *refWalker) walkPipe(pipe *parse.PipeNode, dot []string, known bool) {
+	if pipe == nil {
+		return
+	}
+
+	if len(pipe.Decl) > 0 {
+		if path, ok := w.resolvePipe(pipe, dot, known); ok {
+			w.exact[strings.Join(path, ".")] = true
+			for _, v := range pipe.Decl {
+				w.vars[v.Ident[0]] = path
+			}
+			return
+		}
+	}
+
+	for _, cmd := range pipe.Cmds {
+		if path, ok := w.resolveIndex(cmd, dot, known); ok {
+			w.whole[strings.Join(path, ".")] = true
+			continue
+		}
+
+		if name, arg, ok := includeCall(cmd); ok {
+			path, ok := w.resolve(arg, dot, known)
+			if !ok {
+				w.walkArg(arg, dot, known)
+			}
+			w.call(name, path, ok)
+			continue
+		}
+
+		for _, arg := range cmd.Args {
+			w.walkArg(arg, dot, known)
+		}
+	}
+}
+
+// walkArg marks the values used in the argument of a command.
+func (w *refWalker) walkArg(arg parse.Node, dot []string, known bool) {
+	switch a := arg.(type) {
+	case *parse.PipeNode:
+		w.walkPipe(a, dot, known)
+	case *parse.ChainNode:
+		if p, ok := a.Node.(*parse.PipeNode); ok {
+			w.walkPipe(p, dot, known)
+		}
+	default:
+		if path, ok := w.resolve(arg, dot, known); ok {
+			w.whole[strings.Join(path, ".")] = true
+		}
+	}
+}
+
+// resolvePipe returns the path of the value if the pipeline is a single value.
+func (w *refWalker) resolvePipe(pipe *parse.PipeNode, dot []string, known bool) ([]string, bool) {
+	if pipe == nil || len(pipe.Cmds) != 1 {
+		return nil, false
+	}
+
+	cmd := pipe.Cmds[0]
+	if path, ok := w.resolveIndex(cmd, dot, known); ok {
+		return path, true
+	}
+
+	if len(cmd.Args) != 1 {
+		return nil, false
+	}
+	return w.resolve(cmd.Args[0], dot, known)
+}
+
+// resolveIndex returns the path of `index value "key"...` with constant keys.
+func (w *refWalker) resolveIndex(cmd *parse.CommandNode, dot []string, known bool) ([]string, bool) {
+	if len(cmd.Args) < 3 {
+		return nil, false
+	}
+
+	if ident, ok := cmd.Args[0].(*parse.IdentifierNode); !ok || ident.Ident != "index" {
+		return nil, false
+	}
+
+	path, ok := w.resolve(cmd.Args[1], dot, known)
+	if !ok {
+		return nil, false
+	}
+
+	for _, arg := range cmd.Args[2:] {
+		s, ok := arg.(*parse.StringNode)
+		if !ok {
+			return nil, false
+		}
+		path = append(path[:len(path):len(path)], s.Text)
+	}
+	return path, true
+}
+
+// includeCall returns the name and the value of `include "name" value`.
+func includeCall(cmd *parse.CommandNode) (string, parse.Node, bool) {
+	if len(cmd.Args) != 3 {
+		return "", nil, false
+	}
+
+	if ident, ok := cmd.Args[0].(*parse.IdentifierNode); !ok || ident.Ident != "include" {
+		return "", nil, false
+	}
+
+	name, ok := cmd.Args[1].(*parse.StringNode)
+	if !ok {
+		return "", nil, false
+	}
+	return name.Text, cmd.Args[2], true
+}
+
+// resolve returns the path of the value if it is known.
+func (w *refWalker) resolve(node parse.Node, dot []string, known bool) ([]string, bool) {
+	switch n := node.(type) {
+	case *parse.DotNode:
+		return dot, known
+	case *parse.FieldNode:
+		if !known {
+			return nil, false
+		}
+		return append(dot[:len(dot):len(dot)], n.Ident...), true
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" {
+			return n.Ident[1:], true
+		}
+		if path, ok := w.vars[n.Ident[0]]; ok {
+			return append(path[:len(path):len(path)], n.Ident[1:]...), true
+		}
+	case *parse.PipeNode:
+		return w.resolvePipe(n, dot, known)
+	}
+	return nil, false
+}
@@ -0,0 +1,57 @@
+package casper
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/miracl/casper/source"
+)
+
+func TestUnusedKeys(t *testing.T) {
+	values := map[string]interface{}{
+		"key1": "var1",
+		"key2": "var2",
+		"db": map[interface{}]interface{}{
+			"host": "localhost",
+			"port": 5432,
+		},
+		"hosts": []interface{}{"a", "b"},
+		"empty": map[string]interface{}{},
+	}
+
+	testCases := []struct {
+		tmpl   string
+		unused []string
+	}{
+		{``, []string{"db.host", "db.port", "empty", "hosts", "key1", "key2"}},
+		{`{{.key1}} {{.db.host}}`, []string{"db.port", "empty", "hosts", "key2"}},
+		{`{{.db | toYaml}} {{if .key1}}{{.key2}}{{end}}`, []string{"empty", "hosts"}},
+		{`{{with .db}}{{.port}}{{end}}`, []string{"db.host", "empty", "hosts", "key1", "key2"}},
+		{`{{range .hosts}}{{.}}{{end}} {{$.empty}}`, []string{"db.host", "db.port", "key1", "key2"}},
+		{`{{range $k, $v := .db}}{{$k}}{{end}}`, []string{"empty", "hosts", "key1", "key2"}},
+		{`{{$db := .db}}{{$db.host}} {{index . "key1"}} {{index .db "port"}}`, []string{"empty", "hosts", "key2"}},
+		{`{{define "db"}}{{.host}}{{end}}{{template "db" .db}}`, []string{"db.port", "empty", "hosts", "key1", "key2"}},
+		{`{{define "db"}}{{.host}}{{end}}{{include "db" .db | indent 2}}`, []string{"db.port", "empty", "hosts", "key1", "key2"}},
+		{`{{template "missing" .db}}`, []string{"empty", "hosts", "key1", "key2"}},
+		{`{{toJson .}}`, []string{}},
+		{`{{template "all" .}}{{define "all"}}{{.}}{{end}}`, []string{}},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			unused, err := BuildConfig{
+				Template: strings.NewReader(tc.tmpl),
+				Source:   source.NewSource(values),
+			}.UnusedKeys()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(unused, tc.unused) {
+				t.Errorf("Got %v; want %v", unused, tc.unused)
+			}
+		})
+	}
+}
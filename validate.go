@@ -0,0 +1,88 @@
+package casper
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Violation is a value in the config that doesn't match the schema.
+type Violation struct {
+	// Path is the JSON path of the value, e.g. $.db.port.
+	Path    string
+	Message string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%v: %v", v.Path, v.Message)
+}
+
+// ValidationError is returned when the config doesn't match the schema.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		lines[i] = "\t" + v.String()
+	}
+	return "config doesn't match the schema:\n" + strings.Join(lines, "\n")
+}
+
+// Validate validates the config against the JSON Schema in the schema file.
+// The config is parsed like the storages parse it and all violations are
+// returned in a *ValidationError.
+func Validate(config []byte, format, schema string) error {
+	doc := map[string]interface{}{}
+	switch format {
+	case "json":
+		if err := json.Unmarshal(config, &doc); err != nil {
+			return errors.Wrap(err, "parsing json failed")
+		}
+	case "yaml", "yml":
+		if err := yaml.Unmarshal(config, &doc); err != nil {
+			return errors.Wrap(err, "parsing yaml failed")
+		}
+	default:
+		return fmt.Errorf("validating %v config is not supported", format)
+	}
+
+	path, err := filepath.Abs(schema)
+	if err != nil {
+		return errors.Wrapf(err, "resolving schema %v failed", schema)
+	}
+
+	res, err := gojsonschema.Validate(
+		gojsonschema.NewReferenceLoader("file://"+filepath.ToSlash(path)),
+		gojsonschema.NewGoLoader(normalize(doc)),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "loading schema %v failed", schema)
+	}
+
+	if res.Valid() {
+		return nil
+	}
+
+	violations := make([]Violation, len(res.Errors()))
+	for i, e := range res.Errors() {
+		violations[i] = Violation{
+			Path:    "$" + strings.TrimPrefix(e.Context().String(), "(root)"),
+			Message: e.Description(),
+		}
+	}
+	sort.Slice(violations, func(i, j int) bool {
+		if violations[i].Path != violations[j].Path {
+			return violations[i].Path < violations[j].Path
+		}
+		return violations[i].Message < violations[j].Message
+	})
+	return &ValidationError{violations}
+}
@@ -0,0 +1,94 @@
+package casper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "casper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	schema := `{
+  "type": "object",
+  "required": ["name", "db"],
+  "properties": {
+    "name": {"type": "string"},
+    "db": {
+      "type": "object",
+      "required": ["host"],
+      "properties": {
+        "host": {"type": "string"},
+        "port": {"type": "integer", "maximum": 65535}
+      }
+    },
+    "servers": {"type": "array", "items": {"type": "string"}},
+    "level": {"enum": ["debug", "info"]}
+  }
+}`
+	schemaPath := filepath.Join(dir, "schema.json")
+	if err := ioutil.WriteFile(schemaPath, []byte(schema), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		config     string
+		format     string
+		schema     string
+		violations []Violation
+		err        string
+	}{
+		{"name: svc\ndb:\n  host: localhost\n  port: 5432\nservers: [a, b]\n", "yaml", schemaPath, nil, ""},
+		{`{"name": "svc", "db": {"host": "localhost", "port": 5432}}`, "json", schemaPath, nil, ""},
+		{
+			"name: 1\ndb:\n  port: 70000\nservers: [a, 2]\nlevel: trace\n", "yml", schemaPath,
+			[]Violation{
+				{"$.db", "host is required"},
+				{"$.db.port", "Must be less than or equal to 65535"},
+				{"$.level", "level must be one of the following: \"debug\", \"info\""},
+				{"$.name", "Invalid type. Expected: string, given: integer"},
+				{"$.servers.1", "Invalid type. Expected: string, given: integer"},
+			}, "",
+		},
+		{"{}", "json", schemaPath, []Violation{{"$", "db is required"}, {"$", "name is required"}}, ""},
+		{"key: val", "toml", schemaPath, nil, "validating toml config is not supported"},
+		{"{", "json", schemaPath, nil, "parsing json failed"},
+		{"{}", "json", filepath.Join(dir, "missing.json"), nil, "loading schema"},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("Case%v", i), func(t *testing.T) {
+			err := Validate([]byte(tc.config), tc.format, tc.schema)
+			if err == nil {
+				if tc.violations != nil || tc.err != "" {
+					t.Fatal("Validate should have failed but haven't")
+				}
+				return
+			}
+
+			if tc.err != "" {
+				if !strings.HasPrefix(err.Error(), tc.err) {
+					t.Errorf("Got %v; want %v", err, tc.err)
+				}
+				return
+			}
+
+			verr, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(verr.Violations, tc.violations) {
+				t.Errorf("Got %v; want %v", verr.Violations, tc.violations)
+			}
+		})
+	}
+}